@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/avetis74/12_app_factors/storage"
+
+	_ "github.com/lib/pq" // Драйвер для PostgreSQL
+)
+
+// Ретранслятор outbox: публикует события пользователей из таблицы outbox
+// в поток Redis. Запускается отдельным процессом рядом с API.
+func main() {
+	// Фактор XI: Логи как потоки событий
+	log.SetOutput(os.Stdout)
+
+	// Фактор III: Конфигурация из переменных окружения
+	connStr := os.Getenv("DATABASE_URL")
+	if connStr == "" {
+		log.Fatal("DATABASE_URL environment variable is not set")
+	}
+
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		log.Fatal("REDIS_URL environment variable is not set")
+	}
+
+	stream := os.Getenv("OUTBOX_STREAM")
+	if stream == "" {
+		stream = storage.DefaultEventStream
+	}
+
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		log.Fatalf("could not connect to database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		log.Fatalf("database is not reachable: %v", err)
+	}
+
+	redisCache, err := storage.NewRedisCache(redisURL)
+	if err != nil {
+		log.Fatalf("could not connect to Redis: %v", err)
+	}
+	defer redisCache.Close()
+
+	publisher := storage.NewRedisStreamPublisher(redisCache, stream)
+	relay := storage.NewOutboxRelay(db, publisher)
+
+	if v := os.Getenv("OUTBOX_BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid OUTBOX_BATCH_SIZE %q: must be a positive integer", v)
+		}
+		relay.BatchSize = n
+	}
+	if v := os.Getenv("OUTBOX_POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("invalid OUTBOX_POLL_INTERVAL %q: must be a positive duration", v)
+		}
+		relay.PollInterval = d
+	}
+	if v := os.Getenv("OUTBOX_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("invalid OUTBOX_RETENTION %q: must be a non-negative duration", v)
+		}
+		relay.Retention = d
+	}
+
+	// Фактор IX: Disposability - остановка по сигналу
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Publishing outbox events to Redis stream %s", stream)
+	if err := relay.Run(ctx); err != nil && err != context.Canceled {
+		log.Fatalf("outbox relay failed: %v", err)
+	}
+	log.Println("Relay exited")
+}
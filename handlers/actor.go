@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// headerActor — заголовок с идентификатором автора изменений. Его проставляет
+// шлюз аутентификации перед сервисом.
+const headerActor = "X-Actor"
+
+// maxActorLength соответствует размеру колонки user_events.actor.
+const maxActorLength = 255
+
+// ActorMiddleware помещает автора изменений из заголовка X-Actor в контекст
+// запроса, откуда его читает хранилище при записи истории.
+func ActorMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		actor := strings.TrimSpace(c.Request().Header.Get(headerActor))
+		if len([]rune(actor)) > maxActorLength {
+			actor = string([]rune(actor)[:maxActorLength])
+		}
+		if actor != "" {
+			req := c.Request()
+			c.SetRequest(req.WithContext(storage.WithActor(req.Context(), actor)))
+		}
+		return next(c)
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func TestActorMiddleware(t *testing.T) {
+	long := strings.Repeat("я", maxActorLength+10)
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"header", "alice", "alice"},
+		{"trimmed", "  bob\t", "bob"},
+		{"missing", "", storage.AnonymousActor},
+		{"blank", "   ", storage.AnonymousActor},
+		{"truncated by runes", long, strings.Repeat("я", maxActorLength)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			e := echo.New()
+			e.Use(ActorMiddleware)
+			e.GET("/", func(c echo.Context) error {
+				got = storage.ActorFromContext(c.Request().Context())
+				return c.NoContent(http.StatusNoContent)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(headerActor, tt.header)
+			}
+			e.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("actor = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// headerAdminToken — заголовок с токеном администратора.
+const headerAdminToken = "X-Admin-Token"
+
+var errAdminRequired = NewAPIError(http.StatusForbidden, CodeForbidden,
+	"This operation requires administrator privileges")
+
+// isAdmin проверяет токен администратора из заголовка запроса.
+func (h *UserHandler) isAdmin(c echo.Context) bool {
+	return hasAdminToken(c, h.AdminToken)
+}
+
+// hasAdminToken сообщает, передан ли в запросе токен администратора
+// adminToken. Пустой adminToken отключает административные операции.
+func hasAdminToken(c echo.Context, adminToken string) bool {
+	if adminToken == "" {
+		return false
+	}
+	token := c.Request().Header.Get(headerAdminToken)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// purgeResponse описывает результат окончательного удаления пользователей.
+type purgeResponse struct {
+	Purged    int    `json:"purged"`
+	Retention string `json:"retention"`
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, мягко удаленных
+// раньше срока хранения PurgeRetention. Доступно только администратору.
+func (h *UserHandler) PurgeDeletedUsers(c echo.Context) error {
+	if !h.isAdmin(c) {
+		return errAdminRequired
+	}
+
+	ids, err := h.Store.PurgeDeletedUsers(c.Request().Context(), h.PurgeRetention)
+	if err != nil {
+		return fmt.Errorf("purging deleted users: %w", err)
+	}
+
+	return c.JSON(http.StatusOK, purgeResponse{
+		Purged:    len(ids),
+		Retention: h.PurgeRetention.String(),
+	})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func TestRestoreUserRequiresAdmin(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminToken string
+		header     string
+		status     int
+	}{
+		{"no token", "secret", "", http.StatusForbidden},
+		{"wrong token", "secret", "guess", http.StatusForbidden},
+		{"admin disabled", "", "", http.StatusForbidden},
+		{"admin", "secret", "secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := storage.NewMemoryStore()
+			h := NewUserHandler(store)
+			h.AdminToken = tt.adminToken
+			e := echo.New()
+			e.HTTPErrorHandler = HTTPErrorHandler
+			e.POST("/users/:id/restore", h.RestoreUser)
+
+			user := &storage.User{Name: "Ann", Email: "ann@example.com", Status: "active"}
+			if err := store.CreateUser(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.DeleteUser(ctx, user.ID, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/users/"+strconv.Itoa(user.ID)+"/restore", nil)
+			if tt.header != "" {
+				req.Header.Set(headerAdminToken, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("POST restore: status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			_, err := store.GetUser(ctx, user.ID)
+			if tt.status == http.StatusForbidden {
+				if p := decodeProblem(t, rec); p.Code != CodeForbidden {
+					t.Errorf("problem code = %q, want %q", p.Code, CodeForbidden)
+				}
+				if !errors.Is(err, storage.ErrNotFound) {
+					t.Errorf("GetUser after rejected restore: err = %v, want ErrNotFound", err)
+				}
+			} else if err != nil {
+				t.Errorf("GetUser after restore: %v", err)
+			}
+		})
+	}
+}
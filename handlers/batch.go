@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// maxImportUsers ограничивает число пользователей в одном запросе импорта.
+const maxImportUsers = 1000
+
+var (
+	errBatchUnsupported = NewAPIError(http.StatusNotImplemented, CodeNotImplemented,
+		"Batch operations are not supported by the storage backend")
+	errInvalidUserIDs = NewAPIError(http.StatusBadRequest, CodeInvalidParam,
+		fmt.Sprintf("ids must be a comma-separated list of 1 to %d positive user IDs", storage.MaxPageSize))
+)
+
+// batchStore возвращает хранилище с пакетными операциями.
+func (h *UserHandler) batchStore() (storage.BatchUserStore, error) {
+	batch, ok := h.Store.(storage.BatchUserStore)
+	if !ok {
+		return nil, errBatchUnsupported
+	}
+	return batch, nil
+}
+
+// parseUserIDs разбирает список ID пользователей вида 1,2,3.
+func parseUserIDs(param string) ([]int, error) {
+	if param == "" {
+		return nil, errInvalidUserIDs
+	}
+	parts := strings.Split(param, ",")
+	if len(parts) > storage.MaxPageSize {
+		return nil, errInvalidUserIDs
+	}
+	ids := make([]int, 0, len(parts))
+	for _, part := range parts {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || id < 1 {
+			return nil, errInvalidUserIDs
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// GetUsersByIDs обрабатывает запрос нескольких пользователей по списку ID
+// из параметра ids. Пользователи читаются одним пакетом; отсутствующие
+// пропускаются, порядок ответа совпадает с порядком ids.
+func (h *UserHandler) GetUsersByIDs(c echo.Context) error {
+	ids, err := parseUserIDs(c.QueryParam("ids"))
+	if err != nil {
+		return err
+	}
+	batch, err := h.batchStore()
+	if err != nil {
+		return err
+	}
+
+	users, err := batch.GetUsersByIDs(c.Request().Context(), ids)
+	if err != nil {
+		return fmt.Errorf("fetching users by IDs: %w", err)
+	}
+	return c.JSON(http.StatusOK, usersPage{Data: newUserResponses(users)})
+}
+
+// ImportUsers создает пользователей из тела запроса одной операцией: либо
+// все, либо ни одного. Доступно только администратору.
+func (h *UserHandler) ImportUsers(c echo.Context) error {
+	if !h.isAdmin(c) {
+		return errAdminRequired
+	}
+	batch, err := h.batchStore()
+	if err != nil {
+		return err
+	}
+
+	var req ImportUsersRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidInput.WithErr(err)
+	}
+	if err := req.validate(c); err != nil {
+		return err
+	}
+
+	users := req.toUsers()
+	if err := batch.BulkCreateUsers(c.Request().Context(), users); err != nil {
+		return fmt.Errorf("importing %d users: %w", len(users), err)
+	}
+
+	resp := make([]UserResponse, 0, len(users))
+	for _, u := range users {
+		resp = append(resp, newUserResponse(u))
+	}
+	return c.JSON(http.StatusCreated, usersPage{Data: resp})
+}
+
+// validate проверяет каждого пользователя запроса и собирает ошибки всех
+// полей с индексом пользователя в имени поля.
+func (r *ImportUsersRequest) validate(c echo.Context) error {
+	if len(r.Users) == 0 || len(r.Users) > maxImportUsers {
+		return &ValidationError{Fields: []FieldError{{
+			Field:  "users",
+			Reason: fmt.Sprintf("must contain 1 to %d users", maxImportUsers),
+		}}}
+	}
+
+	var fields []FieldError
+	for i := range r.Users {
+		err := c.Validate(&r.Users[i])
+		if err == nil {
+			continue
+		}
+		var valErr *ValidationError
+		if !errors.As(err, &valErr) {
+			return err
+		}
+		for _, f := range valErr.Fields {
+			f.Field = fmt.Sprintf("users[%d].%s", i, f.Field)
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
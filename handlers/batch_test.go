@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/avetis74/12_app_factors/storage/storagetest"
+	"github.com/labstack/echo/v4"
+)
+
+// withBatch подключает к тестовому серверу пакетные операции.
+func withBatch() testServerOption {
+	return func(e *echo.Echo, store storage.UserStore) storage.UserStore {
+		return storagetest.BatchStore{UserStore: store}
+	}
+}
+
+// decodeUsers разбирает список пользователей из ответа со статусом status.
+func decodeUsers(t *testing.T, rec *httptest.ResponseRecorder, status int) []UserResponse {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, status, rec.Body)
+	}
+	var page usersPage
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	return page.Data
+}
+
+func TestGetUsersByIDs(t *testing.T) {
+	ctx := context.Background()
+	e, store := newTestServer(t, withBatch())
+	ann := &storage.User{Name: "Ann", Email: "ann@example.com", Status: "active"}
+	bob := &storage.User{Name: "Bob", Email: "bob@example.com", Status: "active"}
+	for _, u := range []*storage.User{ann, bob} {
+		if err := store.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	target := "/users/batch?ids=" + strings.Join([]string{strconv.Itoa(bob.ID), "999", strconv.Itoa(ann.ID)}, ",")
+	users := decodeUsers(t, serve(e, http.MethodGet, target, "", ""), http.StatusOK)
+	want := []UserResponse{newUserResponse(bob), newUserResponse(ann)}
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("GET %s = %+v, want %+v", target, users, want)
+	}
+
+	tooMany := strings.TrimSuffix(strings.Repeat("1,", storage.MaxPageSize+1), ",")
+	for _, ids := range []string{"", "a", "0", "1,,2", "-1", tooMany} {
+		rec := serve(e, http.MethodGet, "/users/batch?ids="+ids, "", "")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("ids=%.20s: status = %d, want %d", ids, rec.Code, http.StatusBadRequest)
+			continue
+		}
+		if p := decodeProblem(t, rec); p.Code != CodeInvalidParam {
+			t.Errorf("ids=%.20s: problem code = %q, want %q", ids, p.Code, CodeInvalidParam)
+		}
+	}
+}
+
+func TestBatchOperationsUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []testServerOption
+	}{
+		{"plain store", nil},
+		// CachedUserStore реализует BatchUserStore, но хранилище под ним — нет
+		{"cached store", []testServerOption{withCache(storage.NewMemoryCache())}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, _ := newTestServer(t, tt.opts...)
+			get := serve(e, http.MethodGet, "/users/batch?ids=1", "", "")
+			imp := importUsers(e, testAdminToken, `{"users":[{"name":"Ann","email":"ann@example.com"}]}`)
+			for _, rec := range []*httptest.ResponseRecorder{get, imp} {
+				if rec.Code != http.StatusNotImplemented {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNotImplemented, rec.Body)
+				}
+				if p := decodeProblem(t, rec); p.Code != CodeNotImplemented {
+					t.Errorf("problem code = %q, want %q", p.Code, CodeNotImplemented)
+				}
+			}
+		})
+	}
+}
+
+// importUsers выполняет запрос импорта с токеном администратора token.
+func importUsers(e *echo.Echo, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/import", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(headerAdminToken, token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestImportUsers(t *testing.T) {
+	e, store := newTestServer(t, withBatch())
+	body := `{"users":[
+		{"name":"Ann","email":"ann@example.com"},
+		{"name":"Bob","email":"bob@example.com","status":"inactive","id":999}
+	]}`
+
+	if rec := importUsers(e, "", body); rec.Code != http.StatusForbidden {
+		t.Fatalf("import without admin token: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	users := decodeUsers(t, importUsers(e, testAdminToken, body), http.StatusCreated)
+	if len(users) != 2 || users[0].Name != "Ann" || users[1].Status != "inactive" || users[1].ID == 999 {
+		t.Fatalf("imported users = %+v, want Ann and inactive Bob with store IDs", users)
+	}
+	for _, u := range users {
+		got, err := store.GetUser(context.Background(), u.ID)
+		if err != nil {
+			t.Fatalf("GetUser(%d): %v", u.ID, err)
+		}
+		if resp := newUserResponse(got); resp != u {
+			t.Errorf("stored user = %+v, want %+v", resp, u)
+		}
+	}
+}
+
+func TestImportUsersValidation(t *testing.T) {
+	e, store := newTestServer(t, withBatch())
+	tests := []struct {
+		name   string
+		body   string
+		fields []FieldError
+	}{
+		{
+			name:   "empty",
+			body:   `{"users":[]}`,
+			fields: []FieldError{{"users", "must contain 1 to 1000 users"}},
+		},
+		{
+			name: "fields of every user",
+			body: `{"users":[{"name":"Ann","email":"ann"},{"name":"","email":"bob@example.com","status":"admin"}]}`,
+			fields: []FieldError{
+				{"users[0].email", "must be a valid email address"},
+				{"users[1].name", "is required"},
+				{"users[1].status", "must be one of: active, inactive, suspended"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := importUsers(e, testAdminToken, tt.body)
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusUnprocessableEntity, rec.Body)
+			}
+			if p := decodeProblem(t, rec); !reflect.DeepEqual(p.Errors, tt.fields) {
+				t.Errorf("errors = %+v, want %+v", p.Errors, tt.fields)
+			}
+		})
+	}
+
+	page, err := store.ListUsers(context.Background(), storage.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Users) != 0 {
+		t.Errorf("rejected imports created %d users", len(page.Users))
+	}
+}
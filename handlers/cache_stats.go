@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// CacheStatsHandler возвращает обработчик статистики кеша: попадания,
+// промахи, ошибки, записи, сбросы и задержки по пространствам имен ключей,
+// состояние локального уровня и Redis (INFO и пул соединений). INFO
+// раскрывает устройство Redis, поэтому статистика доступна только
+// администратору с токеном adminToken, как и другие административные
+// операции. Обработчик только читает и не изменяет данные в кеше. local
+// и redis могут быть nil, если они не настроены.
+func CacheStatsHandler(adminToken string, store *storage.CachedUserStore, local *storage.TieredCache, redis *storage.ReconnectingCache) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !hasAdminToken(c, adminToken) {
+			return errAdminRequired
+		}
+
+		stats := map[string]interface{}{
+			"namespaces": store.Stats(),
+		}
+		if local != nil {
+			stats["local"] = local.LocalStats()
+		}
+		if redis != nil {
+			status := redis.Status()
+			redisStats := map[string]interface{}{
+				"state": status.State,
+				"pool":  redis.Redis().PoolStats(),
+			}
+			if status.State == storage.CacheStateAvailable {
+				info, err := redis.Redis().Info(c.Request().Context(), "memory", "stats", "keyspace", "clients")
+				if err != nil {
+					redisStats["error"] = err.Error()
+				} else {
+					redisStats["info"] = info
+				}
+			} else {
+				redisStats["error"] = status.LastError
+			}
+			stats["redis"] = redisStats
+		}
+		return c.JSON(http.StatusOK, stats)
+	}
+}
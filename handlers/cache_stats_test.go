@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/avetis74/12_app_factors/storage/storagetest"
+	"github.com/labstack/echo/v4"
+)
+
+// writeSpyCache считает операции, изменяющие кеш в памяти.
+type writeSpyCache struct {
+	*storage.MemoryCache
+	writes atomic.Int64
+}
+
+func (c *writeSpyCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	c.writes.Add(1)
+	return c.MemoryCache.Set(ctx, key, value, expiration)
+}
+
+func (c *writeSpyCache) Delete(ctx context.Context, key string) error {
+	c.writes.Add(1)
+	return c.MemoryCache.Delete(ctx, key)
+}
+
+func (c *writeSpyCache) DeletePattern(ctx context.Context, pattern string) error {
+	c.writes.Add(1)
+	return c.MemoryCache.DeletePattern(ctx, pattern)
+}
+
+// getCacheStats запрашивает статистику кеша с токеном администратора token.
+func getCacheStats(e *echo.Echo, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/cache/stats", nil)
+	if token != "" {
+		req.Header.Set(headerAdminToken, token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCacheStatsHandlerRequiresAdmin(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminToken string
+		header     string
+	}{
+		{"no token", testAdminToken, ""},
+		{"wrong token", testAdminToken, "guess"},
+		{"admin disabled", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewCachedUserStore(storage.NewMemoryStore(), storage.NewMemoryCache())
+			e := echo.New()
+			e.HTTPErrorHandler = HTTPErrorHandler
+			e.GET("/cache/stats", CacheStatsHandler(tt.adminToken, store, nil, storagetest.DegradedCache(t)))
+
+			rec := getCacheStats(e, tt.header)
+			if rec.Code != http.StatusForbidden {
+				t.Fatalf("GET /cache/stats: status = %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body)
+			}
+			if p := decodeProblem(t, rec); p.Code != CodeForbidden {
+				t.Errorf("problem code = %q, want %q", p.Code, CodeForbidden)
+			}
+		})
+	}
+}
+
+func TestCacheStatsHandler(t *testing.T) {
+	ctx := context.Background()
+	cache := &writeSpyCache{MemoryCache: storage.NewMemoryCache()}
+	store := storage.NewCachedUserStore(storage.NewMemoryStore(), cache)
+	user := &storage.User{Name: "Ann", Email: "ann@example.com", Status: "active"}
+	if err := store.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.GET("/cache/stats", CacheStatsHandler(testAdminToken, store, nil, nil))
+	writes := cache.writes.Load()
+
+	for i := 0; i < 3; i++ {
+		rec := getCacheStats(e, testAdminToken)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /cache/stats: status = %d, want %d", rec.Code, http.StatusOK)
+		}
+
+		var stats struct {
+			Namespaces map[string]storage.CacheNamespaceStats `json:"namespaces"`
+			Redis      interface{}                            `json:"redis"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body, err)
+		}
+		if got := stats.Namespaces["user"]; got.Hits != 1 || got.Sets != 1 {
+			t.Errorf("namespaces[user] = %+v, want 1 hit and 1 set", got)
+		}
+		if stats.Redis != nil {
+			t.Errorf("redis = %v, want no Redis section without Redis", stats.Redis)
+		}
+	}
+
+	if n := cache.writes.Load() - writes; n != 0 {
+		t.Errorf("GET /cache/stats wrote to the cache %d times, want none", n)
+	}
+	if got := store.Stats()["user"]; got.Hits != 1 || got.Misses != 0 {
+		t.Errorf("Stats()[user] after GET /cache/stats = %+v, want no extra reads", got)
+	}
+}
+
+func TestCacheStatsHandlerDegradedRedis(t *testing.T) {
+	redis := storagetest.DegradedCache(t)
+	store := storage.NewCachedUserStore(storage.NewMemoryStore(), redis)
+
+	e := echo.New()
+	e.GET("/cache/stats", CacheStatsHandler(testAdminToken, store, nil, redis))
+	rec := getCacheStats(e, testAdminToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /cache/stats: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var stats struct {
+		Redis struct {
+			State string                 `json:"state"`
+			Error string                 `json:"error"`
+			Info  map[string]interface{} `json:"info"`
+		} `json:"redis"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body, err)
+	}
+	if stats.Redis.State != storage.CacheStateDegraded || stats.Redis.Error == "" || stats.Redis.Info != nil {
+		t.Errorf("redis = %+v, want degraded state with the last error and no INFO", stats.Redis)
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// headerCache сообщает, получен ли ответ из кеша: HIT или MISS.
+	headerCache = "X-Cache"
+	// headerAge — возраст закешированного значения в секундах.
+	headerAge = "Age"
+)
+
+// CacheStatusMiddleware показывает клиенту и в логе, использовал ли запрос
+// кеш: X-Cache: HIT или MISS, а при попадании — Age с возрастом значения
+// в секундах. Запросы, не обращавшиеся к кешу, заголовков не получают.
+func CacheStatusMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx, recorder := storage.WithCacheRecorder(req.Context())
+		c.SetRequest(req.WithContext(ctx))
+
+		// Заголовки выставляются перед отправкой ответа, в том числе ответа
+		// об ошибке, например закешированного 404
+		res := c.Response()
+		res.Before(func() {
+			hit, age, ok := recorder.Result()
+			if !ok {
+				return
+			}
+			status := "MISS"
+			if hit {
+				status = "HIT"
+				seconds := max(int(age.Seconds()), 0)
+				res.Header().Set(headerAge, strconv.Itoa(seconds))
+			}
+			res.Header().Set(headerCache, status)
+			log.Printf("Cache %s for %s %s (request %s, age %v)", status, req.Method, req.URL.Path,
+				res.Header().Get(echo.HeaderXRequestID), age.Round(time.Millisecond))
+		})
+
+		return next(c)
+	}
+}
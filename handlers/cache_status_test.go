@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// expectCacheHeaders проверяет X-Cache и Age ответа; пустой age — заголовка нет.
+func expectCacheHeaders(t *testing.T, rec *httptest.ResponseRecorder, status int, xCache, age string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, status, rec.Body)
+	}
+	if got := rec.Header().Get(headerCache); got != xCache {
+		t.Errorf("X-Cache = %q, want %q", got, xCache)
+	}
+	if got := rec.Header().Get(headerAge); got != age {
+		t.Errorf("Age = %q, want %q", got, age)
+	}
+}
+
+func TestCacheStatusHeaders(t *testing.T) {
+	ctx := context.Background()
+	cache := storage.NewMemoryCache()
+	e, store := newTestServer(t, withCache(cache))
+	user := &storage.User{Name: "Ann", Email: "ann@example.com", Status: "active"}
+	if err := store.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	key := "user:" + strconv.Itoa(user.ID)
+	target := "/users/" + strconv.Itoa(user.ID)
+
+	expectCacheHeaders(t, serve(e, http.MethodGet, target, "", ""), http.StatusOK, "MISS", "")
+	expectCacheHeaders(t, serve(e, http.MethodGet, target, "", ""), http.StatusOK, "HIT", "0")
+
+	// Состариваем закешированное значение: Age отсчитывается от времени записи
+	var entry map[string]interface{}
+	if err := cache.Get(ctx, key, &entry); err != nil {
+		t.Fatal(err)
+	}
+	entry["written_at"] = time.Now().Add(-42 * time.Second)
+	if err := cache.Set(ctx, key, entry, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	expectCacheHeaders(t, serve(e, http.MethodGet, target, "", ""), http.StatusOK, "HIT", "42")
+}
+
+func TestCacheStatusHeadersNotFound(t *testing.T) {
+	e, _ := newTestServer(t, withCache(storage.NewMemoryCache()))
+
+	expectCacheHeaders(t, serve(e, http.MethodGet, "/users/999", "", ""), http.StatusNotFound, "MISS", "")
+	// Повторный запрос отвечает закешированным отсутствием
+	expectCacheHeaders(t, serve(e, http.MethodGet, "/users/999", "", ""), http.StatusNotFound, "HIT", "0")
+}
+
+func TestCacheStatusHeadersWithoutCache(t *testing.T) {
+	e := echo.New()
+	e.Use(CacheStatusMiddleware)
+	e.GET("/ping", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+
+	expectCacheHeaders(t, serve(e, http.MethodGet, "/ping", "", ""), http.StatusNoContent, "", "")
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/avetis74/12_app_factors/storage"
+)
+
+// CreateUserRequest описывает тело запроса на создание пользователя.
+// Клиент может задать только перечисленные поля: ID и служебные поля
+// назначаются хранилищем.
+type CreateUserRequest struct {
+	Name   string `json:"name" validate:"required,notblank,max=255"`
+	Email  string `json:"email" validate:"required,max=255,rfc5322"`
+	Status string `json:"status" validate:"omitempty,oneof=active inactive suspended"`
+}
+
+// ImportUsersRequest описывает тело запроса на пакетное создание пользователей.
+type ImportUsersRequest struct {
+	Users []CreateUserRequest `json:"users"`
+}
+
+// UpdateUserRequest описывает тело запроса на полное обновление пользователя.
+type UpdateUserRequest struct {
+	Name   string `json:"name" validate:"required,notblank,max=255"`
+	Email  string `json:"email" validate:"required,max=255,rfc5322"`
+	Status string `json:"status" validate:"omitempty,oneof=active inactive suspended"`
+}
+
+// PatchUserRequest описывает частичное обновление пользователя
+// в формате JSON Merge Patch (RFC 7396). Отсутствующие поля не изменяются.
+type PatchUserRequest struct {
+	Name   *string `json:"name" validate:"omitnil,notblank,max=255"`
+	Email  *string `json:"email" validate:"omitnil,max=255,rfc5322"`
+	Status *string `json:"status" validate:"omitnil,oneof=active inactive suspended"`
+}
+
+// UserResponse — представление пользователя в ответах API.
+type UserResponse struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Status string `json:"status"`
+	// DeletedAt возвращается только для мягко удаленных пользователей
+	// (при include_deleted=true).
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// UserEventResponse — представление записи истории изменений в ответах API.
+type UserEventResponse struct {
+	ID        int             `json:"id"`
+	Actor     string          `json:"actor"`
+	Operation string          `json:"operation"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// toUser преобразует запрос в модель хранилища.
+func (r *CreateUserRequest) toUser() *storage.User {
+	return &storage.User{Name: r.Name, Email: r.Email, Status: r.Status}
+}
+
+// toUsers преобразует запрос в модели хранилища.
+func (r *ImportUsersRequest) toUsers() []*storage.User {
+	users := make([]*storage.User, 0, len(r.Users))
+	for i := range r.Users {
+		users = append(users, r.Users[i].toUser())
+	}
+	return users
+}
+
+// toUser преобразует запрос в модель хранилища.
+func (r *UpdateUserRequest) toUser() *storage.User {
+	return &storage.User{Name: r.Name, Email: r.Email, Status: r.Status}
+}
+
+// toPatch преобразует запрос в патч хранилища.
+func (r *PatchUserRequest) toPatch() storage.UserPatch {
+	return storage.UserPatch{Name: r.Name, Email: r.Email, Status: r.Status}
+}
+
+// decodeMergePatch разбирает документ JSON Merge Patch. Все поля пользователя
+// обязательны, поэтому null (удаление поля по RFC 7396) и неизвестные поля
+// отклоняются с перечнем ошибок по каждому полю.
+func decodeMergePatch(body []byte) (*PatchUserRequest, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil || doc == nil {
+		return nil, errInvalidInput.WithErr(errors.New("merge patch must be a JSON object"))
+	}
+
+	var (
+		req    PatchUserRequest
+		fields []FieldError
+	)
+	targets := map[string]**string{
+		"name":   &req.Name,
+		"email":  &req.Email,
+		"status": &req.Status,
+	}
+
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		raw := doc[key]
+		target, ok := targets[key]
+		if !ok {
+			fields = append(fields, FieldError{Field: key, Reason: "is not a known field"})
+			continue
+		}
+		if string(raw) == "null" {
+			fields = append(fields, FieldError{Field: key, Reason: "cannot be removed"})
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			fields = append(fields, FieldError{Field: key, Reason: "must be a string"})
+			continue
+		}
+		*target = &value
+	}
+
+	if len(fields) > 0 {
+		return nil, &ValidationError{Fields: fields}
+	}
+	return &req, nil
+}
+
+// newUserResponse строит представление пользователя для ответа.
+func newUserResponse(u *storage.User) UserResponse {
+	return UserResponse{
+		ID:        u.ID,
+		Name:      u.Name,
+		Email:     u.Email,
+		Status:    u.Status,
+		DeletedAt: u.DeletedAt,
+	}
+}
+
+// newUserResponses строит представления для списка пользователей.
+func newUserResponses(users []storage.User) []UserResponse {
+	resp := make([]UserResponse, 0, len(users))
+	for i := range users {
+		resp = append(resp, newUserResponse(&users[i]))
+	}
+	return resp
+}
+
+// newUserEventResponses строит представления для списка событий истории.
+func newUserEventResponses(events []storage.UserEvent) []UserEventResponse {
+	resp := make([]UserEventResponse, 0, len(events))
+	for _, e := range events {
+		resp = append(resp, UserEventResponse{
+			ID:        e.ID,
+			Actor:     e.Actor,
+			Operation: e.Operation,
+			Before:    e.Before,
+			After:     e.After,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	return resp
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func TestDecodeMergePatch(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name   string
+		body   string
+		want   *PatchUserRequest
+		fields []FieldError
+	}{
+		{
+			name: "empty patch changes nothing",
+			body: `{}`,
+			want: &PatchUserRequest{},
+		},
+		{
+			name: "absent fields stay nil",
+			body: `{"name":"Bob"}`,
+			want: &PatchUserRequest{Name: str("Bob")},
+		},
+		{
+			name: "all fields",
+			body: `{"name":"Bob","email":"bob@example.com","status":"inactive"}`,
+			want: &PatchUserRequest{Name: str("Bob"), Email: str("bob@example.com"), Status: str("inactive")},
+		},
+		{
+			name: "empty string is a value, not a removal",
+			body: `{"name":""}`,
+			want: &PatchUserRequest{Name: str("")},
+		},
+		{
+			name:   "null removes a required field",
+			body:   `{"email":null}`,
+			fields: []FieldError{{"email", "cannot be removed"}},
+		},
+		{
+			name:   "unknown field",
+			body:   `{"id":7}`,
+			fields: []FieldError{{"id", "is not a known field"}},
+		},
+		{
+			name:   "wrong type",
+			body:   `{"status":1}`,
+			fields: []FieldError{{"status", "must be a string"}},
+		},
+		{
+			name: "all errors reported in key order",
+			body: `{"role":"admin","name":null,"email":{}}`,
+			fields: []FieldError{
+				{"email", "must be a string"},
+				{"name", "cannot be removed"},
+				{"role", "is not a known field"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeMergePatch([]byte(tt.body))
+			if tt.fields != nil {
+				var valErr *ValidationError
+				if !errors.As(err, &valErr) {
+					t.Fatalf("decodeMergePatch() error = %v, want *ValidationError", err)
+				}
+				if !reflect.DeepEqual(valErr.Fields, tt.fields) {
+					t.Errorf("Fields = %+v, want %+v", valErr.Fields, tt.fields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeMergePatch() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeMergePatch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeMergePatchRejectsNonObject(t *testing.T) {
+	for _, body := range []string{`null`, `[]`, `"name"`, `{"name":`} {
+		_, err := decodeMergePatch([]byte(body))
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != CodeInvalidInput {
+			t.Errorf("decodeMergePatch(%s) error = %v, want %s", body, err, CodeInvalidInput)
+		}
+	}
+}
+
+func TestPatchUser(t *testing.T) {
+	e, store := newTestServer(t)
+	user := &storage.User{Name: "Ann", Email: "ann@example.com", Status: "active"}
+	if err := store.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	target := "/users/" + strconv.Itoa(user.ID)
+
+	rec := serve(e, http.MethodPatch, target, MIMEMergePatchJSON, `{"name":"Annie"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var resp UserResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := UserResponse{ID: user.ID, Name: "Annie", Email: "ann@example.com", Status: "active"}
+	if resp != want {
+		t.Errorf("PATCH response = %+v, want %+v", resp, want)
+	}
+
+	rec = serve(e, http.MethodPatch, target, MIMEMergePatchJSON, `{"status":null}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("null status: status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	rec = serve(e, http.MethodPatch, target, "text/plain", `{"name":"Bob"}`)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("text/plain: status = %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+
+	got, err := store.GetUser(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Annie" || got.Status != "active" {
+		t.Errorf("stored user = %+v, rejected patches must not change it", got)
+	}
+}
+
+// serverFields — поля, которые назначает хранилище. Клиент передает их
+// в теле запроса вместе с неизвестным полем.
+const serverFields = `"id":999,"created_at":"2000-01-01T00:00:00Z","version":42,"deleted_at":"2000-01-02T00:00:00Z","role":"admin"`
+
+// expectUserResponse проверяет, что в теле ответа нет служебных полей
+// хранилища и полей запроса, и разбирает его.
+func expectUserResponse(t *testing.T, body []byte) UserResponse {
+	t.Helper()
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	for _, key := range []string{"created_at", "updated_at", "version", "deleted_at", "role"} {
+		if _, ok := fields[key]; ok {
+			t.Errorf("response %s contains %q", body, key)
+		}
+	}
+	var resp UserResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestCreateUserIgnoresServerFields(t *testing.T) {
+	e, store := newTestServer(t)
+	started := time.Now()
+
+	body := `{"name":"Ann","email":"ann@example.com",` + serverFields + `}`
+	rec := serve(e, http.MethodPost, "/users", echo.MIMEApplicationJSON, body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /users: status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	resp := expectUserResponse(t, rec.Body.Bytes())
+	if resp.ID == 999 {
+		t.Errorf("response ID = 999, want the ID assigned by the store")
+	}
+
+	got, err := store.GetUser(context.Background(), resp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := UserResponse{ID: got.ID, Name: "Ann", Email: "ann@example.com", Status: "active"}
+	if resp != want {
+		t.Errorf("POST response = %+v, want %+v", resp, want)
+	}
+	if got.Version != 1 || got.CreatedAt.Before(started) || got.DeletedAt != nil {
+		t.Errorf("stored user = %+v, want version 1, created now and not deleted", got)
+	}
+	if _, err := store.GetUser(context.Background(), 999); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetUser(999) err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUpdateUserIgnoresServerFields(t *testing.T) {
+	ctx := context.Background()
+	e, store := newTestServer(t)
+	user := &storage.User{Name: "Ann", Email: "ann@example.com", Status: "active"}
+	if err := store.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	created, err := store.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// version из тела не становится ожидаемой версией: иначе обновление
+	// отклонилось бы с 412
+	body := `{"name":"Bob","email":"bob@example.com","status":"inactive",` + serverFields + `}`
+	rec := serve(e, http.MethodPut, "/users/"+strconv.Itoa(user.ID), echo.MIMEApplicationJSON, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT: status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	resp := expectUserResponse(t, rec.Body.Bytes())
+	want := UserResponse{ID: user.ID, Name: "Bob", Email: "bob@example.com", Status: "inactive"}
+	if resp != want {
+		t.Errorf("PUT response = %+v, want %+v", resp, want)
+	}
+
+	got, err := store.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != created.Version+1 || !got.CreatedAt.Equal(created.CreatedAt) || got.DeletedAt != nil {
+		t.Errorf("stored user = %+v, want version %d, created_at %v and not deleted",
+			got, created.Version+1, created.CreatedAt)
+	}
+	if _, err := store.GetUser(ctx, 999); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetUser(999) err = %v, want ErrNotFound", err)
+	}
+}
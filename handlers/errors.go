@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// MIMEProblemJSON — тип содержимого ответов об ошибках (RFC 7807).
+const MIMEProblemJSON = "application/problem+json"
+
+// Машиночитаемые коды ошибок API.
+const (
+	CodeInvalidInput         = "invalid_input"
+	CodeInvalidUserID        = "invalid_user_id"
+	CodeInvalidParam         = "invalid_parameter"
+	CodeInvalidCursor        = "invalid_cursor"
+	CodeUnsupportedMedia     = "unsupported_media_type"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodeValidation           = "validation_failed"
+	CodeUnavailable          = "unavailable"
+	CodeCanceled             = "request_canceled"
+	CodeTimeout              = "timeout"
+	CodeNotImplemented       = "not_implemented"
+	CodeInternal             = "internal_error"
+	CodeRouteNotFound        = "route_not_found"
+	CodeMethodNotAllow       = "method_not_allowed"
+)
+
+// StatusClientClosedRequest — нестандартный статус (введен nginx) для
+// запросов, которые клиент отменил, не дождавшись ответа.
+const StatusClientClosedRequest = 499
+
+// Problem описывает тело ответа об ошибке в формате RFC 7807.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+	// Errors перечисляет невалидные поля запроса (только для validation_failed).
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// APIError — ошибка, которую обработчики возвращают вместо того, чтобы
+// формировать ответ самостоятельно. Ответ строит HTTPErrorHandler.
+type APIError struct {
+	Status int
+	Code   string
+	Detail string
+	Err    error
+}
+
+// NewAPIError создает новую ошибку API.
+func NewAPIError(status int, code, detail string) *APIError {
+	return &APIError{Status: status, Code: code, Detail: detail}
+}
+
+// Error реализует интерфейс error.
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return e.Detail + ": " + e.Err.Error()
+	}
+	return e.Detail
+}
+
+// Unwrap возвращает исходную ошибку.
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// WithErr возвращает копию ошибки с прикрепленной причиной для логов.
+func (e *APIError) WithErr(err error) *APIError {
+	cp := *e
+	cp.Err = err
+	return &cp
+}
+
+var (
+	errInvalidUserID = NewAPIError(http.StatusBadRequest, CodeInvalidUserID, "User ID must be a positive integer")
+	errInvalidInput  = NewAPIError(http.StatusBadRequest, CodeInvalidInput, "Request body could not be parsed")
+)
+
+// problemFromError сопоставляет ошибку с описанием проблемы для клиента.
+// Детали внутренних ошибок клиенту не раскрываются.
+func problemFromError(err error) Problem {
+	var (
+		apiErr  *APIError
+		valErr  *ValidationError
+		httpErr *echo.HTTPError
+	)
+	switch {
+	case errors.As(err, &valErr):
+		p := newProblem(http.StatusUnprocessableEntity, CodeValidation, "Request contains invalid fields")
+		p.Errors = valErr.Fields
+		return p
+	case errors.As(err, &apiErr):
+		return newProblem(apiErr.Status, apiErr.Code, apiErr.Detail)
+	case errors.Is(err, storage.ErrInvalidCursor):
+		return newProblem(http.StatusBadRequest, CodeInvalidCursor, "Cursor is malformed or does not match the requested sort order")
+	case errors.Is(err, storage.ErrNotFound):
+		return newProblem(http.StatusNotFound, CodeNotFound, "User not found")
+	case errors.Is(err, storage.ErrConflict):
+		return newProblem(http.StatusConflict, CodeConflict, "User with this email already exists")
+	case errors.Is(err, storage.ErrPreconditionFailed):
+		return newProblem(http.StatusPreconditionFailed, CodePreconditionFailed, "User was modified by another request")
+	case errors.Is(err, storage.ErrValidation):
+		return newProblem(http.StatusUnprocessableEntity, CodeValidation, "User data was rejected by the storage constraints")
+	case errors.Is(err, storage.ErrUnavailable):
+		return newProblem(http.StatusServiceUnavailable, CodeUnavailable, "Storage is temporarily unavailable")
+	case errors.Is(err, errors.ErrUnsupported):
+		return newProblem(http.StatusNotImplemented, CodeNotImplemented, errBatchUnsupported.Detail)
+	case errors.Is(err, storage.ErrCanceled), errors.Is(err, context.Canceled):
+		return newProblem(StatusClientClosedRequest, CodeCanceled, "Request was canceled by the client")
+	case errors.Is(err, storage.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return newProblem(http.StatusGatewayTimeout, CodeTimeout, "Storage did not respond in time")
+	case errors.As(err, &httpErr):
+		detail := ""
+		if msg, ok := httpErr.Message.(string); ok {
+			detail = msg
+		}
+		return newProblem(httpErr.Code, httpStatusCode(httpErr.Code), detail)
+	default:
+		return newProblem(http.StatusInternalServerError, CodeInternal, "")
+	}
+}
+
+// newProblem создает Problem с типом и заголовком, выведенными из статуса и кода.
+func newProblem(status int, code, detail string) Problem {
+	return Problem{
+		Type:   "/problems/" + strings.ReplaceAll(code, "_", "-"),
+		Title:  statusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// statusText возвращает заголовок проблемы для HTTP-статуса.
+func statusText(status int) string {
+	if status == StatusClientClosedRequest {
+		return "Client Closed Request"
+	}
+	return http.StatusText(status)
+}
+
+// httpStatusCode возвращает код ошибки для собственных ошибок echo.
+func httpStatusCode(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return CodeRouteNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllow
+	case http.StatusBadRequest:
+		return CodeInvalidInput
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// HTTPErrorHandler — централизованный обработчик ошибок echo. Все ошибки,
+// включая ошибки маршрутизации и паники из middleware.Recover, превращаются
+// в ответ application/problem+json.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	p := problemFromError(err)
+	p.Instance = c.Request().URL.Path
+	p.RequestID = c.Response().Header().Get(echo.HeaderXRequestID)
+
+	// Фактор XI: Логи как потоки событий
+	if p.Status == StatusClientClosedRequest {
+		log.Printf("Request %s %s canceled by client (request_id=%s)",
+			c.Request().Method, c.Request().URL.Path, p.RequestID)
+	} else {
+		log.Printf("Request %s %s failed with %d (request_id=%s): %v",
+			c.Request().Method, c.Request().URL.Path, p.Status, p.RequestID, err)
+	}
+
+	if p.Status == http.StatusServiceUnavailable {
+		c.Response().Header().Set("Retry-After", "5")
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(p.Status)
+	} else {
+		var body []byte
+		body, err = json.Marshal(p)
+		if err == nil {
+			err = c.Blob(p.Status, MIMEProblemJSON, body)
+		}
+	}
+	if err != nil {
+		log.Printf("Error writing error response: %v", err)
+	}
+}
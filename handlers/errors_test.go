@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// testServerOption настраивает сервер newTestServer и может обернуть
+// хранилище, с которым работают обработчики.
+type testServerOption func(e *echo.Echo, store storage.UserStore) storage.UserStore
+
+// withCache подключает к тестовому серверу CachedUserStore с кешем cache
+// и CacheStatusMiddleware.
+func withCache(cache storage.CacheService) testServerOption {
+	return func(e *echo.Echo, store storage.UserStore) storage.UserStore {
+		e.Use(CacheStatusMiddleware)
+		return storage.NewCachedUserStore(store, cache)
+	}
+}
+
+// testAdminToken — токен администратора сервера newTestServer.
+const testAdminToken = "secret"
+
+// newTestServer создает echo с обработчиком ошибок и валидатором приложения
+// и маршрутами пользователей поверх хранилища в памяти.
+func newTestServer(t *testing.T, opts ...testServerOption) (*echo.Echo, *storage.MemoryStore) {
+	t.Helper()
+	store := storage.NewMemoryStore()
+
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.Validator = NewValidator()
+	e.Use(ActorMiddleware)
+	var userStore storage.UserStore = store
+	for _, opt := range opts {
+		userStore = opt(e, userStore)
+	}
+	h := NewUserHandler(userStore)
+	h.AdminToken = testAdminToken
+	e.POST("/users", h.CreateUser)
+	e.GET("/users/:id", h.GetUser)
+	e.GET("/users/:id/history", h.GetUserHistory)
+	e.GET("/users/batch", h.GetUsersByIDs)
+	e.POST("/admin/users/import", h.ImportUsers)
+	e.PUT("/users/:id", h.UpdateUser)
+	e.PATCH("/users/:id", h.PatchUser)
+	e.DELETE("/users/:id", h.DeleteUser)
+	return e, store
+}
+
+// serve выполняет запрос к серверу и возвращает записанный ответ.
+func serve(e *echo.Echo, method, target, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set(echo.HeaderContentType, contentType)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeProblem проверяет тип содержимого и разбирает тело problem+json.
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if ct := rec.Header().Get(echo.HeaderContentType); ct != MIMEProblemJSON {
+		t.Fatalf("Content-Type = %q, want %q", ct, MIMEProblemJSON)
+	}
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode problem %q: %v", rec.Body.String(), err)
+	}
+	return p
+}
+
+func TestProblemFromError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"api error", errInvalidUserID, http.StatusBadRequest, CodeInvalidUserID},
+		{"wrapped api error", fmt.Errorf("handler: %w", errInvalidInput.WithErr(errors.New("eof"))), http.StatusBadRequest, CodeInvalidInput},
+		{"validation", &ValidationError{Fields: []FieldError{{Field: "name", Reason: "is required"}}}, http.StatusUnprocessableEntity, CodeValidation},
+		{"invalid cursor", fmt.Errorf("listing: %w", storage.ErrInvalidCursor), http.StatusBadRequest, CodeInvalidCursor},
+		{"not found", fmt.Errorf("fetching user 1: %w", storage.ErrNotFound), http.StatusNotFound, CodeNotFound},
+		{"conflict", storage.ErrConflict, http.StatusConflict, CodeConflict},
+		{"precondition failed", storage.ErrPreconditionFailed, http.StatusPreconditionFailed, CodePreconditionFailed},
+		{"storage validation", storage.ErrValidation, http.StatusUnprocessableEntity, CodeValidation},
+		{"unavailable", storage.ErrUnavailable, http.StatusServiceUnavailable, CodeUnavailable},
+		{"canceled", fmt.Errorf("%w: %w", storage.ErrCanceled, context.Canceled), StatusClientClosedRequest, CodeCanceled},
+		{"canceled wait", context.Canceled, StatusClientClosedRequest, CodeCanceled},
+		{"timeout", fmt.Errorf("%w: %w", storage.ErrTimeout, context.DeadlineExceeded), http.StatusGatewayTimeout, CodeTimeout},
+		{"timeout wait", fmt.Errorf("loading user: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, CodeTimeout},
+		{"echo not found", echo.ErrNotFound, http.StatusNotFound, CodeRouteNotFound},
+		{"echo method not allowed", echo.ErrMethodNotAllowed, http.StatusMethodNotAllowed, CodeMethodNotAllow},
+		{"echo unsupported media", echo.ErrUnsupportedMediaType, http.StatusUnsupportedMediaType, "unsupported_media_type"},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := problemFromError(tt.err)
+			if p.Status != tt.status || p.Code != tt.code {
+				t.Errorf("problemFromError() = %d %q, want %d %q", p.Status, p.Code, tt.status, tt.code)
+			}
+			if p.Title == "" || p.Title != statusText(tt.status) {
+				t.Errorf("Title = %q, want %q", p.Title, statusText(tt.status))
+			}
+			if want := "/problems/" + strings.ReplaceAll(tt.code, "_", "-"); p.Type != want {
+				t.Errorf("Type = %q, want %q", p.Type, want)
+			}
+		})
+	}
+}
+
+func TestProblemFromErrorHidesInternalDetails(t *testing.T) {
+	p := problemFromError(errors.New("pq: password authentication failed"))
+	if p.Detail != "" {
+		t.Errorf("Detail = %q, want empty", p.Detail)
+	}
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		status int
+		code   string
+	}{
+		{"invalid id", http.MethodGet, "/users/abc", http.StatusBadRequest, CodeInvalidUserID},
+		{"missing user", http.MethodGet, "/users/42", http.StatusNotFound, CodeNotFound},
+		{"unknown route", http.MethodGet, "/nope", http.StatusNotFound, CodeRouteNotFound},
+		{"wrong method", http.MethodPost, "/users/1", http.StatusMethodNotAllowed, CodeMethodNotAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(e, tt.method, tt.target, "", "")
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			p := decodeProblem(t, rec)
+			if p.Status != tt.status || p.Code != tt.code {
+				t.Errorf("problem = %d %q, want %d %q", p.Status, p.Code, tt.status, tt.code)
+			}
+			if want := strings.SplitN(tt.target, "?", 2)[0]; p.Instance != want {
+				t.Errorf("Instance = %q, want %q", p.Instance, want)
+			}
+		})
+	}
+}
+
+func TestHTTPErrorHandlerRequestIDAndRetryAfter(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.GET("/down", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+		return fmt.Errorf("listing users: %w", storage.ErrUnavailable)
+	})
+
+	rec := serve(e, http.MethodGet, "/down", "", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("Retry-After = %q, want 5", got)
+	}
+	if p := decodeProblem(t, rec); p.RequestID != "req-1" {
+		t.Errorf("RequestID = %q, want req-1", p.RequestID)
+	}
+}
+
+func TestHTTPErrorHandlerHead(t *testing.T) {
+	e, _ := newTestServer(t)
+	e.HEAD("/users/:id", func(c echo.Context) error { return storage.ErrNotFound })
+
+	rec := serve(e, http.MethodHead, "/users/1", "", "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("HEAD response has body %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// Заголовки условных запросов (RFC 9110).
+const (
+	headerETag        = "ETag"
+	headerIfMatch     = "If-Match"
+	headerIfNoneMatch = "If-None-Match"
+)
+
+var (
+	errPreconditionRequired = NewAPIError(http.StatusPreconditionRequired, CodePreconditionRequired,
+		"If-Match header with the current ETag is required")
+	errPreconditionFailed = NewAPIError(http.StatusPreconditionFailed, CodePreconditionFailed,
+		"User was modified by another request")
+)
+
+// userETag возвращает сильный ETag для текущей версии пользователя.
+func userETag(u *storage.User) string {
+	return fmt.Sprintf(`"%d"`, u.Version)
+}
+
+// setUserETag добавляет ETag пользователя в заголовки ответа.
+func setUserETag(c echo.Context, u *storage.User) {
+	c.Response().Header().Set(headerETag, userETag(u))
+}
+
+// parseETags разбирает список ETag из заголовков If-Match / If-None-Match.
+// Слабые ETag пропускаются: для условных изменений используется строгое сравнение.
+func parseETags(header string) (versions []int, wildcard bool) {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil, true
+		}
+		if !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) || len(tag) < 2 {
+			continue
+		}
+		v, err := strconv.Atoi(tag[1 : len(tag)-1])
+		if err == nil && v > 0 {
+			versions = append(versions, v)
+		}
+	}
+	return versions, false
+}
+
+// expectedVersion возвращает версию пользователя, которую клиент указал
+// в If-Match. Ноль означает, что условие не задано. Если передано несколько
+// ETag, выбирается совпадающий с текущей версией, а само изменение остается
+// условным по этой версии, поэтому проверка по-прежнему атомарна.
+func (h *UserHandler) expectedVersion(c echo.Context, id int) (int, error) {
+	header := c.Request().Header.Get(headerIfMatch)
+	if header == "" {
+		if h.RequireIfMatch {
+			return 0, errPreconditionRequired
+		}
+		return 0, nil
+	}
+
+	versions, wildcard := parseETags(header)
+	if wildcard {
+		return 0, nil
+	}
+	switch len(versions) {
+	case 0:
+		return 0, errPreconditionFailed
+	case 1:
+		return versions[0], nil
+	}
+
+	user, err := h.Store.GetUser(storage.WithPrimary(c.Request().Context()), id)
+	if err != nil {
+		return 0, fmt.Errorf("fetching user %d: %w", id, err)
+	}
+	for _, v := range versions {
+		if v == user.Version {
+			return v, nil
+		}
+	}
+	return 0, errPreconditionFailed
+}
+
+// notModified сообщает, совпадает ли текущий ETag с одним из If-None-Match.
+func notModified(c echo.Context, u *storage.User) bool {
+	header := c.Request().Header.Get(headerIfNoneMatch)
+	if header == "" {
+		return false
+	}
+	versions, wildcard := parseETags(strings.ReplaceAll(header, "W/", ""))
+	if wildcard {
+		return true
+	}
+	for _, v := range versions {
+		if v == u.Version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseETags(t *testing.T) {
+	tests := []struct {
+		header   string
+		versions []int
+		wildcard bool
+	}{
+		{``, nil, false},
+		{`"3"`, []int{3}, false},
+		{` "3" `, []int{3}, false},
+		{`"1", "2","3"`, []int{1, 2, 3}, false},
+		{`*`, nil, true},
+		{`"1", *`, nil, true},
+		{`W/"3"`, nil, false},
+		{`W/"3", "4"`, []int{4}, false},
+		{`3`, nil, false},
+		{`"`, nil, false},
+		{`""`, nil, false},
+		{`"abc"`, nil, false},
+		{`"0"`, nil, false},
+		{`"-1"`, nil, false},
+		{`"3`, nil, false},
+		{`"3", garbage, "5"`, []int{3, 5}, false},
+	}
+	for _, tt := range tests {
+		versions, wildcard := parseETags(tt.header)
+		if !reflect.DeepEqual(versions, tt.versions) || wildcard != tt.wildcard {
+			t.Errorf("parseETags(%q) = %v, %v; want %v, %v",
+				tt.header, versions, wildcard, tt.versions, tt.wildcard)
+		}
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	user := &storage.User{ID: 1, Version: 3}
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{``, false},
+		{`"3"`, true},
+		{`"2"`, false},
+		{`W/"3"`, true},
+		{`"1", W/"3"`, true},
+		{`"1", "2"`, false},
+		{`*`, true},
+		{`bogus`, false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		if tt.header != "" {
+			req.Header.Set(headerIfNoneMatch, tt.header)
+		}
+		c := echo.New().NewContext(req, httptest.NewRecorder())
+		if got := notModified(c, user); got != tt.want {
+			t.Errorf("notModified(If-None-Match: %s) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		require bool
+		status  int
+	}{
+		{"no precondition", "", false, http.StatusNoContent},
+		{"precondition required", "", true, http.StatusPreconditionRequired},
+		{"current version", `"1"`, true, http.StatusNoContent},
+		{"stale version", `"7"`, true, http.StatusPreconditionFailed},
+		{"list with current version", `"7", "1"`, true, http.StatusNoContent},
+		{"list without current version", `"7", "8"`, true, http.StatusPreconditionFailed},
+		{"wildcard", `*`, true, http.StatusNoContent},
+		{"weak tag", `W/"1"`, true, http.StatusPreconditionFailed},
+		{"invalid value", `abc`, true, http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewMemoryStore()
+			h := NewUserHandler(store)
+			h.RequireIfMatch = tt.require
+			e := echo.New()
+			e.HTTPErrorHandler = HTTPErrorHandler
+			e.DELETE("/users/:id", h.DeleteUser)
+
+			user := &storage.User{Name: "Ann", Email: "ann@example.com", Status: "active"}
+			if err := store.CreateUser(context.Background(), user); err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/users/"+strconv.Itoa(user.ID), nil)
+			if tt.ifMatch != "" {
+				req.Header.Set(headerIfMatch, tt.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("DELETE with If-Match %s: status = %d, want %d: %s",
+					tt.ifMatch, rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestGetUserETag(t *testing.T) {
+	e, store := newTestServer(t)
+	user := &storage.User{Name: "Ann", Email: "ann@example.com", Status: "active"}
+	if err := store.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	target := "/users/" + strconv.Itoa(user.ID)
+
+	rec := serve(e, http.MethodGet, target, "", "")
+	etag := rec.Header().Get(headerETag)
+	if want := `"` + strconv.Itoa(user.Version) + `"`; etag != want {
+		t.Fatalf("ETag = %q, want %q", etag, want)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set(headerIfNoneMatch, etag)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match %s: status = %d, want %d", etag, rec.Code, http.StatusNotModified)
+	}
+}
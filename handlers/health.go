@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// HealthHandler возвращает обработчик проверки здоровья. Без Redis сервис
+// работает, но медленнее, поэтому недоступный кеш дает состояние degraded,
+// а не ошибку. replicas и cache могут быть nil, если они не настроены.
+func HealthHandler(replicas *storage.ReplicaSet, cache *storage.ReconnectingCache) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		health := map[string]interface{}{"status": "healthy"}
+		if replicas != nil {
+			health["replicas"] = replicas.Status()
+		}
+		if cache != nil {
+			status := cache.Status()
+			health["cache"] = status
+			if status.State != storage.CacheStateAvailable {
+				health["status"] = "degraded"
+			}
+		}
+		return c.JSON(http.StatusOK, health)
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/avetis74/12_app_factors/storage/storagetest"
+	"github.com/labstack/echo/v4"
+)
+
+func TestHealthHandlerReportsDegradedCache(t *testing.T) {
+	cache := storagetest.DegradedCache(t)
+
+	e := echo.New()
+	e.GET("/health", HealthHandler(nil, cache))
+	rec := serve(e, http.MethodGet, "/health", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /health: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var health struct {
+		Status string              `json:"status"`
+		Cache  storage.CacheStatus `json:"cache"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body, err)
+	}
+	if health.Status != "degraded" || health.Cache.State != storage.CacheStateDegraded || health.Cache.LastError == "" {
+		t.Errorf("GET /health = %s, want degraded status with the cache error", rec.Body)
+	}
+}
+
+func TestHealthHandlerWithoutCache(t *testing.T) {
+	e := echo.New()
+	e.GET("/health", HealthHandler(nil, nil))
+	rec := serve(e, http.MethodGet, "/health", "", "")
+
+	var health map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	if health["status"] != "healthy" || health["cache"] != nil {
+		t.Errorf("GET /health = %s, want healthy without cache status", rec.Body)
+	}
+}
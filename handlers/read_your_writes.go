@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// cookiePrimaryUntil хранит момент (Unix, мс), до которого чтение клиента
+	// направляется на основной сервер.
+	cookiePrimaryUntil = "primary_until"
+	// headerPrimaryUntil дублирует cookie для клиентов без поддержки cookie:
+	// клиент возвращает полученное значение в следующих запросах.
+	headerPrimaryUntil = "X-Primary-Until"
+)
+
+// maxClockSkew — допустимое расхождение часов экземпляров сервиса. Отметку
+// дальше now+window+maxClockSkew сервис выдать не мог: ее подделал клиент,
+// чтобы навсегда читать с основного сервера, поэтому она игнорируется.
+const maxClockSkew = time.Second
+
+// ReadYourWritesMiddleware гарантирует, что клиент видит собственные записи
+// при чтении с реплик: после изменяющего запроса клиент на время window
+// привязывается к основному серверу через cookie или заголовок.
+func ReadYourWritesMiddleware(window time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			now := time.Now()
+
+			if until := pinnedUntil(req); until.After(now) && !until.After(now.Add(window+maxClockSkew)) {
+				c.SetRequest(req.WithContext(storage.WithPrimary(req.Context())))
+			}
+
+			// Отметку ставим до обработчика, пока заголовки еще не отправлены.
+			// Если запись не удалась, клиент лишь недолго читает с основного сервера
+			if !isSafeMethod(req.Method) {
+				until := strconv.FormatInt(now.Add(window).UnixMilli(), 10)
+				c.SetCookie(&http.Cookie{
+					Name:     cookiePrimaryUntil,
+					Value:    until,
+					Path:     "/",
+					MaxAge:   int(window.Seconds()) + 1,
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+				c.Response().Header().Set(headerPrimaryUntil, until)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// pinnedUntil возвращает момент, до которого запрос нужно читать с основного сервера.
+func pinnedUntil(req *http.Request) time.Time {
+	value := req.Header.Get(headerPrimaryUntil)
+	if value == "" {
+		if cookie, err := req.Cookie(cookiePrimaryUntil); err == nil {
+			value = cookie.Value
+		}
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// isSafeMethod сообщает, что метод не изменяет данные.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
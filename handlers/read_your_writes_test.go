@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestReadYourWritesMiddleware(t *testing.T) {
+	const window = 5 * time.Second
+	ms := func(d time.Duration) string {
+		return strconv.FormatInt(time.Now().Add(d).UnixMilli(), 10)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		pinned bool
+	}{
+		{"no pin", "", "", false},
+		{"header within window", ms(window / 2), "", true},
+		{"cookie within window", "", ms(window / 2), true},
+		{"expired", ms(-time.Second), "", false},
+		{"beyond window", ms(window + time.Minute), "", false},
+		{"far future cookie", "", ms(24 * 365 * time.Hour), false},
+		{"malformed", "soon", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+
+			// Привязанный запрос middleware заменяет запросом с WithPrimary
+			var pinned bool
+			e := echo.New()
+			e.Use(ReadYourWritesMiddleware(window))
+			e.GET("/users", func(c echo.Context) error {
+				pinned = c.Request() != req
+				return c.NoContent(http.StatusOK)
+			})
+
+			if tt.header != "" {
+				req.Header.Set(headerPrimaryUntil, tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: cookiePrimaryUntil, Value: tt.cookie})
+			}
+			e.ServeHTTP(httptest.NewRecorder(), req)
+			if pinned != tt.pinned {
+				t.Errorf("pinned = %v, want %v", pinned, tt.pinned)
+			}
+		})
+	}
+}
+
+func TestReadYourWritesMiddlewareSetsPin(t *testing.T) {
+	const window = 5 * time.Second
+	e := echo.New()
+	e.Use(ReadYourWritesMiddleware(window))
+	e.POST("/users", func(c echo.Context) error { return c.NoContent(http.StatusCreated) })
+
+	before := time.Now()
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users", nil))
+
+	ms, err := strconv.ParseInt(rec.Header().Get(headerPrimaryUntil), 10, 64)
+	if err != nil {
+		t.Fatalf("%s = %q: %v", headerPrimaryUntil, rec.Header().Get(headerPrimaryUntil), err)
+	}
+	until := time.UnixMilli(ms)
+	if until.Before(before.Add(window).Truncate(time.Millisecond)) || until.After(time.Now().Add(window)) {
+		t.Errorf("%s = %v, want about now+%v", headerPrimaryUntil, until, window)
+	}
+}
@@ -1,9 +1,13 @@
 package handlers
 
 import (
-	"log"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/avetis74/12_app_factors/storage"
 	"github.com/labstack/echo/v4"
@@ -12,109 +16,291 @@ import (
 // UserHandler содержит зависимости для обработчиков, в данном случае — хранилище.
 type UserHandler struct {
 	Store storage.UserStore
+	// RequireIfMatch требует заголовок If-Match для PUT, PATCH и DELETE.
+	RequireIfMatch bool
+	// AdminToken открывает административные операции по заголовку X-Admin-Token.
+	// Пустое значение отключает их.
+	AdminToken string
+	// PurgeRetention — срок хранения мягко удаленных пользователей.
+	PurgeRetention time.Duration
 }
 
+// DefaultPurgeRetention — срок хранения мягко удаленных пользователей по умолчанию.
+const DefaultPurgeRetention = 30 * 24 * time.Hour
+
 // NewUserHandler создает новый экземпляр UserHandler.
 func NewUserHandler(s storage.UserStore) *UserHandler {
-	return &UserHandler{Store: s}
+	return &UserHandler{Store: s, PurgeRetention: DefaultPurgeRetention}
+}
+
+// parseUserID извлекает ID пользователя из параметров пути.
+func parseUserID(c echo.Context) (int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 1 {
+		return 0, errInvalidUserID
+	}
+	return id, nil
+}
+
+// parseLimit извлекает размер страницы из параметра limit; 0 — значение по умолчанию.
+func parseLimit(c echo.Context) (int, error) {
+	limit := c.QueryParam("limit")
+	if limit == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 || n > storage.MaxPageSize {
+		return 0, NewAPIError(http.StatusBadRequest, CodeInvalidParam,
+			fmt.Sprintf("limit must be between 1 and %d", storage.MaxPageSize))
+	}
+	return n, nil
+}
+
+// usersPage описывает ответ на запрос списка пользователей.
+type usersPage struct {
+	Data       []UserResponse `json:"data"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	Next       string         `json:"next,omitempty"`
 }
 
-// GetUsers обрабатывает запрос на получение всех пользователей.
+// GetUsers обрабатывает запрос на получение списка пользователей.
+// Поддерживает параметры limit, cursor, status, email_prefix, name_prefix и sort.
 func (h *UserHandler) GetUsers(c echo.Context) error {
-	users, err := h.Store.GetUsers()
+	opts := storage.ListOptions{
+		Cursor:      c.QueryParam("cursor"),
+		Status:      c.QueryParam("status"),
+		EmailPrefix: c.QueryParam("email_prefix"),
+		NamePrefix:  c.QueryParam("name_prefix"),
+	}
+
+	limit, err := parseLimit(c)
+	if err != nil {
+		return err
+	}
+	opts.Limit = limit
+
+	if v := c.QueryParam("include_deleted"); v != "" {
+		includeDeleted, err := strconv.ParseBool(v)
+		if err != nil {
+			return NewAPIError(http.StatusBadRequest, CodeInvalidParam, "include_deleted must be a boolean")
+		}
+		if includeDeleted && !h.isAdmin(c) {
+			return errAdminRequired
+		}
+		opts.IncludeDeleted = includeDeleted
+	}
+
+	sort, ok := storage.ParseSortOrder(c.QueryParam("sort"))
+	if !ok {
+		return NewAPIError(http.StatusBadRequest, CodeInvalidParam, "sort must be one of: id, -id")
+	}
+	opts.Sort = sort
+
+	page, err := h.Store.ListUsers(c.Request().Context(), opts)
 	if err != nil {
-		// Фактор XI: Логи как потоки событий
-		log.Printf("Error fetching users: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Could not fetch users",
-		})
+		return fmt.Errorf("fetching users: %w", err)
 	}
-	return c.JSON(http.StatusOK, users)
+
+	resp := usersPage{Data: newUserResponses(page.Users), NextCursor: page.NextCursor}
+	if page.NextCursor != "" {
+		resp.Next = nextPageLink(c, page.NextCursor)
+		c.Response().Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, resp.Next))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// historyPage описывает ответ на запрос истории изменений пользователя.
+type historyPage struct {
+	Data       []UserEventResponse `json:"data"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+	Next       string              `json:"next,omitempty"`
+}
+
+// GetUserHistory обрабатывает запрос истории изменений пользователя.
+// Поддерживает параметры limit и cursor.
+func (h *UserHandler) GetUserHistory(c echo.Context) error {
+	id, err := parseUserID(c)
+	if err != nil {
+		return err
+	}
+	limit, err := parseLimit(c)
+	if err != nil {
+		return err
+	}
+
+	page, err := h.Store.GetUserHistory(c.Request().Context(), id, storage.HistoryOptions{
+		Cursor: c.QueryParam("cursor"),
+		Limit:  limit,
+	})
+	if err != nil {
+		return fmt.Errorf("fetching history of user %d: %w", id, err)
+	}
+
+	resp := historyPage{Data: newUserEventResponses(page.Events), NextCursor: page.NextCursor}
+	if page.NextCursor != "" {
+		resp.Next = nextPageLink(c, page.NextCursor)
+		c.Response().Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, resp.Next))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// nextPageLink строит ссылку на следующую страницу, сохраняя параметры запроса.
+func nextPageLink(c echo.Context, nextCursor string) string {
+	query := c.Request().URL.Query()
+	query.Set("cursor", nextCursor)
+	u := url.URL{Path: c.Request().URL.Path, RawQuery: query.Encode()}
+	return u.String()
 }
 
 // CreateUser обрабатывает запрос на создание пользователя.
 func (h *UserHandler) CreateUser(c echo.Context) error {
-	var u storage.User
-	if err := c.Bind(&u); err != nil {
-		log.Printf("Error binding user data: %v", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Invalid input",
-		})
+	var req CreateUserRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidInput.WithErr(err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
 	}
 
-	if err := h.Store.CreateUser(&u); err != nil {
-		log.Printf("Error creating user: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Could not create user",
-		})
+	user := req.toUser()
+	if err := h.Store.CreateUser(c.Request().Context(), user); err != nil {
+		return fmt.Errorf("creating user: %w", err)
 	}
 
-	return c.JSON(http.StatusCreated, u)
+	setUserETag(c, user)
+	return c.JSON(http.StatusCreated, newUserResponse(user))
 }
 
 // GetUser обрабатывает запрос на получение одного пользователя.
 func (h *UserHandler) GetUser(c echo.Context) error {
-	id, err := strconv.Atoi(c.Param("id"))
+	id, err := parseUserID(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Invalid user ID",
-		})
+		return err
 	}
 
-	user, err := h.Store.GetUser(id)
+	user, err := h.Store.GetUser(c.Request().Context(), id)
 	if err != nil {
-		log.Printf("Error fetching user %d: %v", id, err)
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "User not found",
-		})
+		return fmt.Errorf("fetching user %d: %w", id, err)
 	}
 
-	return c.JSON(http.StatusOK, user)
+	setUserETag(c, user)
+	if notModified(c, user) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.JSON(http.StatusOK, newUserResponse(user))
 }
 
 // UpdateUser обрабатывает запрос на обновление пользователя.
 func (h *UserHandler) UpdateUser(c echo.Context) error {
-	id, err := strconv.Atoi(c.Param("id"))
+	id, err := parseUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req UpdateUserRequest
+	if err := c.Bind(&req); err != nil {
+		return errInvalidInput.WithErr(err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	version, err := h.expectedVersion(c, id)
+	if err != nil {
+		return err
+	}
+
+	user := req.toUser()
+	user.Version = version
+	if err := h.Store.UpdateUser(c.Request().Context(), id, user); err != nil {
+		return fmt.Errorf("updating user %d: %w", id, err)
+	}
+
+	setUserETag(c, user)
+	return c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// MIMEMergePatchJSON — тип содержимого JSON Merge Patch (RFC 7396).
+const MIMEMergePatchJSON = "application/merge-patch+json"
+
+// PatchUser обрабатывает запрос на частичное обновление пользователя.
+// Изменяются только поля, присутствующие в теле запроса.
+func (h *UserHandler) PatchUser(c echo.Context) error {
+	id, err := parseUserID(c)
+	if err != nil {
+		return err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != MIMEMergePatchJSON && mediaType != echo.MIMEApplicationJSON {
+		return NewAPIError(http.StatusUnsupportedMediaType, CodeUnsupportedMedia,
+			"Content-Type must be "+MIMEMergePatchJSON)
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Invalid user ID",
-		})
+		return errInvalidInput.WithErr(err)
+	}
+	req, err := decodeMergePatch(body)
+	if err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
 	}
 
-	var u storage.User
-	if err := c.Bind(&u); err != nil {
-		log.Printf("Error binding user data: %v", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Invalid input",
-		})
+	version, err := h.expectedVersion(c, id)
+	if err != nil {
+		return err
 	}
 
-	if err := h.Store.UpdateUser(id, &u); err != nil {
-		log.Printf("Error updating user %d: %v", id, err)
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "User not found",
-		})
+	patch := req.toPatch()
+	patch.Version = version
+	user, err := h.Store.PatchUser(c.Request().Context(), id, patch)
+	if err != nil {
+		return fmt.Errorf("patching user %d: %w", id, err)
 	}
 
-	u.ID = id
-	return c.JSON(http.StatusOK, u)
+	setUserETag(c, user)
+	return c.JSON(http.StatusOK, newUserResponse(user))
 }
 
 // DeleteUser обрабатывает запрос на удаление пользователя.
 func (h *UserHandler) DeleteUser(c echo.Context) error {
-	id, err := strconv.Atoi(c.Param("id"))
+	id, err := parseUserID(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Invalid user ID",
-		})
+		return err
 	}
 
-	if err := h.Store.DeleteUser(id); err != nil {
-		log.Printf("Error deleting user %d: %v", id, err)
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "User not found",
-		})
+	version, err := h.expectedVersion(c, id)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Store.DeleteUser(c.Request().Context(), id, version); err != nil {
+		return fmt.Errorf("deleting user %d: %w", id, err)
 	}
 
 	return c.NoContent(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+// RestoreUser обрабатывает запрос на восстановление мягко удаленного
+// пользователя. Доступно только администратору.
+func (h *UserHandler) RestoreUser(c echo.Context) error {
+	if !h.isAdmin(c) {
+		return errAdminRequired
+	}
+
+	id, err := parseUserID(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.Store.RestoreUser(c.Request().Context(), id)
+	if err != nil {
+		return fmt.Errorf("restoring user %d: %w", id, err)
+	}
+
+	setUserETag(c, user)
+	return c.JSON(http.StatusOK, newUserResponse(user))
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// serveAs выполняет запрос с JSON-телом от имени автора actor.
+func serveAs(e *echo.Echo, actor, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if actor != "" {
+		req.Header.Set(headerActor, actor)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeHistory разбирает страницу истории из успешного ответа.
+func decodeHistory(t *testing.T, rec *httptest.ResponseRecorder) historyPage {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET history: status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var page historyPage
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	return page
+}
+
+func TestGetUserHistory(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	rec := serveAs(e, "alice", http.MethodPost, "/users", `{"name":"Ann","email":"ann@example.com"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /users: status = %d: %s", rec.Code, rec.Body)
+	}
+	var created UserResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	target := "/users/" + strconv.Itoa(created.ID)
+	if rec := serveAs(e, "bob", http.MethodPut, target, `{"name":"Annie","email":"ann@example.com"}`); rec.Code != http.StatusOK {
+		t.Fatalf("PUT: status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serveAs(e, "", http.MethodDelete, target, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	// События идут от новых к старым, по два на странице
+	var events []UserEventResponse
+	next := target + "/history?limit=2"
+	for pages := 0; next != ""; pages++ {
+		if pages == 3 {
+			t.Fatal("history pagination does not terminate")
+		}
+		rec := serve(e, http.MethodGet, next, "", "")
+		page := decodeHistory(t, rec)
+		if len(page.Data) > 2 {
+			t.Fatalf("GET %s returned %d events, want at most 2", next, len(page.Data))
+		}
+		if link := rec.Header().Get("Link"); (link != "") != (page.Next != "") {
+			t.Errorf("GET %s: Link = %q with next %q", next, link, page.Next)
+		}
+		events = append(events, page.Data...)
+		next = page.Next
+	}
+
+	want := []struct{ operation, actor string }{
+		{storage.OpDelete, storage.AnonymousActor},
+		{storage.OpUpdate, "bob"},
+		{storage.OpCreate, "alice"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("history has %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		if events[i].Operation != w.operation || events[i].Actor != w.actor {
+			t.Errorf("event %d = %s by %s, want %s by %s", i, events[i].Operation, events[i].Actor, w.operation, w.actor)
+		}
+		if i > 0 && events[i].ID >= events[i-1].ID {
+			t.Errorf("event %d ID %d is not older than %d", i, events[i].ID, events[i-1].ID)
+		}
+	}
+	if string(events[1].Before) != `{"name":"Ann"}` || string(events[1].After) != `{"name":"Annie"}` {
+		t.Errorf("update diff = %s -> %s, want only the name", events[1].Before, events[1].After)
+	}
+}
+
+func TestGetUserHistoryNotFound(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	rec := serve(e, http.MethodGet, "/users/999/history", "", "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("GET unknown user history: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if p := decodeProblem(t, rec); p.Code != CodeNotFound {
+		t.Errorf("problem code = %q, want %q", p.Code, CodeNotFound)
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError описывает ошибку валидации одного поля запроса.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError содержит все ошибки валидации тела запроса.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error реализует интерфейс error.
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		parts = append(parts, f.Field+": "+f.Reason)
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+// Validator реализует echo.Validator на основе декларативных тегов `validate`.
+type Validator struct {
+	validate *validator.Validate
+}
+
+// NewValidator создает валидатор с правилами, специфичными для API.
+func NewValidator() *Validator {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	// В ошибках используем имена полей из JSON, а не из Go-структур
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	// notblank: строка не должна состоять только из пробелов
+	_ = v.RegisterValidation("notblank", func(fl validator.FieldLevel) bool {
+		return strings.TrimSpace(fl.Field().String()) != ""
+	})
+
+	// rfc5322: адрес email без отображаемого имени по RFC 5322
+	_ = v.RegisterValidation("rfc5322", func(fl validator.FieldLevel) bool {
+		s := fl.Field().String()
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Name == "" && addr.Address == s
+	})
+
+	return &Validator{validate: v}
+}
+
+// Validate проверяет структуру и возвращает *ValidationError со списком всех
+// невалидных полей.
+func (cv *Validator) Validate(i interface{}) error {
+	err := cv.validate.Struct(i)
+	if err == nil {
+		return nil
+	}
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return err
+	}
+
+	fields := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fields = append(fields, FieldError{
+			Field:  fe.Field(),
+			Reason: validationReason(fe),
+		})
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// validationReason формирует понятное клиенту описание нарушенного правила.
+func validationReason(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "notblank":
+		return "is required"
+	case "max":
+		return fmt.Sprintf("must be at most %s characters long", fe.Param())
+	case "min":
+		return fmt.Sprintf("must be at least %s characters long", fe.Param())
+	case "rfc5322":
+		return "must be a valid email address"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	default:
+		return fmt.Sprintf("failed the %q rule", fe.Tag())
+	}
+}
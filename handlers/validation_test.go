@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestValidatorMessages(t *testing.T) {
+	v := NewValidator()
+	long := strings.Repeat("a", 256)
+
+	tests := []struct {
+		name string
+		req  CreateUserRequest
+		want []FieldError
+	}{
+		{
+			name: "valid",
+			req:  CreateUserRequest{Name: "Ann", Email: "ann@example.com", Status: "active"},
+		},
+		{
+			name: "valid without status",
+			req:  CreateUserRequest{Name: "Ann", Email: "ann@example.com"},
+		},
+		{
+			name: "missing fields",
+			req:  CreateUserRequest{},
+			want: []FieldError{{"name", "is required"}, {"email", "is required"}},
+		},
+		{
+			name: "blank name",
+			req:  CreateUserRequest{Name: "   ", Email: "ann@example.com"},
+			want: []FieldError{{"name", "is required"}},
+		},
+		{
+			name: "too long",
+			req:  CreateUserRequest{Name: long, Email: long + "@example.com"},
+			want: []FieldError{{"name", "must be at most 255 characters long"}, {"email", "must be at most 255 characters long"}},
+		},
+		{
+			name: "email with display name",
+			req:  CreateUserRequest{Name: "Ann", Email: "Ann <ann@example.com>"},
+			want: []FieldError{{"email", "must be a valid email address"}},
+		},
+		{
+			name: "malformed email",
+			req:  CreateUserRequest{Name: "Ann", Email: "ann.example.com"},
+			want: []FieldError{{"email", "must be a valid email address"}},
+		},
+		{
+			name: "unknown status",
+			req:  CreateUserRequest{Name: "Ann", Email: "ann@example.com", Status: "banned"},
+			want: []FieldError{{"status", "must be one of: active, inactive, suspended"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Validate(&tt.req)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			var valErr *ValidationError
+			if !errors.As(err, &valErr) {
+				t.Fatalf("Validate() = %v, want *ValidationError", err)
+			}
+			if !reflect.DeepEqual(valErr.Fields, tt.want) {
+				t.Errorf("Fields = %+v, want %+v", valErr.Fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateUserValidationProblem(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	rec := serve(e, http.MethodPost, "/users", echo.MIMEApplicationJSON,
+		`{"name":" ","email":"not-an-email","status":"banned"}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusUnprocessableEntity, rec.Body)
+	}
+	p := decodeProblem(t, rec)
+	if p.Code != CodeValidation {
+		t.Errorf("Code = %q, want %q", p.Code, CodeValidation)
+	}
+	want := []FieldError{
+		{"name", "is required"},
+		{"email", "must be a valid email address"},
+		{"status", "must be one of: active, inactive, suspended"},
+	}
+	if !reflect.DeepEqual(p.Errors, want) {
+		t.Errorf("Errors = %+v, want %+v", p.Errors, want)
+	}
+}
+
+func TestCreateUserRejectsMalformedBody(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	rec := serve(e, http.MethodPost, "/users", echo.MIMEApplicationJSON, `{"name":`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if p := decodeProblem(t, rec); p.Code != CodeInvalidInput {
+		t.Errorf("Code = %q, want %q", p.Code, CodeInvalidInput)
+	}
+}
+
+func TestCreateUserValid(t *testing.T) {
+	e, _ := newTestServer(t)
+
+	rec := serve(e, http.MethodPost, "/users", echo.MIMEApplicationJSON,
+		`{"name":"Ann","email":"ann@example.com"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+}
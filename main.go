@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -34,84 +36,277 @@ func main() {
 		log.Fatal("REDIS_URL environment variable is not set")
 	}
 
-	// Подключаемся к базе данных
-	db, err := sql.Open("postgres", connStr)
-	if err != nil {
-		log.Fatalf("could not connect to database: %v", err)
-	}
-	defer db.Close()
+	// Фактор IV: Backing services - драйвер PostgreSQL выбирается конфигурацией
+	var (
+		userStore storage.UserStore
+		pgStore   *storage.PostgresStore
+	)
+	switch driver := os.Getenv("DATABASE_DRIVER"); {
+	case storage.IsMemoryURL(connStr):
+		// Хранилище в памяти для тестов и разработки без PostgreSQL
+		userStore = storage.NewMemoryStore()
+		log.Println("Using in-memory user store: data is lost on restart")
+	case storage.IsSQLiteURL(connStr):
+		// SQLite для установок на одном узле; схема применяется при запуске
+		db, err := storage.OpenSQLite(context.Background(), connStr)
+		if err != nil {
+			log.Fatalf("could not open SQLite database: %v", err)
+		}
+		defer db.Close()
+		userStore = storage.NewSQLiteStore(db)
+	case driver == "" || driver == "pq":
+		db, err := sql.Open("postgres", connStr)
+		if err != nil {
+			log.Fatalf("could not connect to database: %v", err)
+		}
+		defer db.Close()
 
-	if err := db.Ping(); err != nil {
-		log.Fatalf("database is not reachable: %v", err)
+		if err := db.Ping(); err != nil {
+			log.Fatalf("database is not reachable: %v", err)
+		}
+		pgStore = storage.NewPostgresStore(db)
+		userStore = pgStore
+	case driver == "pgx":
+		pool, err := storage.NewPgxPool(context.Background(), connStr)
+		if err != nil {
+			log.Fatalf("database is not reachable: %v", err)
+		}
+		defer pool.Close()
+		userStore = storage.NewPgxStore(pool)
+	default:
+		log.Fatalf("invalid DATABASE_DRIVER %q: must be pq or pgx", driver)
 	}
 
 	log.Println("Database connection successful")
 
-	// Подключаемся к Redis
-	redisCache, err := storage.NewRedisCache(redisURL)
-	if err != nil {
-		log.Fatalf("could not connect to Redis: %v", err)
+	// Подключаемся к Redis. Недоступный Redis не мешает запуску: кеш
+	// отключается, а подключение восстанавливается в фоне
+	var cache storage.CacheService
+	var redisCache *storage.ReconnectingCache
+	var tieredCache *storage.TieredCache
+	if storage.IsMemoryURL(redisURL) {
+		cache = storage.NewMemoryCache()
+		log.Println("Using in-memory cache")
+	} else {
+		var err error
+		redisCache, err = storage.NewReconnectingCache(redisURL)
+		if err != nil {
+			log.Fatalf("invalid REDIS_URL: %v", err)
+		}
+		defer redisCache.Close()
+		// Префикс ключей разделяет приложения и окружения в общем Redis
+		keyPrefix := os.Getenv("CACHE_KEY_PREFIX")
+		if keyPrefix != "" && !strings.HasSuffix(keyPrefix, ":") {
+			keyPrefix += ":"
+		}
+		redisCache.Redis().Prefix = keyPrefix
+
+		// Кодек значений: значения с любым кодеком читаются по заголовку,
+		// поэтому его можно менять поэтапным развертыванием
+		codecName := os.Getenv("CACHE_CODEC")
+		if codecName == "" {
+			codecName = "json"
+		}
+		compression := os.Getenv("CACHE_COMPRESSION")
+		if compression == "" {
+			compression = "none"
+		}
+		threshold := storage.DefaultCompressionThreshold
+		if v := os.Getenv("CACHE_COMPRESSION_THRESHOLD"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				log.Fatalf("invalid CACHE_COMPRESSION_THRESHOLD %q: must be a non-negative integer", v)
+			}
+			threshold = n
+		}
+		codec, err := storage.NewCodec(codecName, compression, threshold)
+		if err != nil {
+			log.Fatalf("invalid cache codec: %v", err)
+		}
+		redisCache.Redis().Codec = codec
+		if err := redisCache.Check(context.Background()); err != nil {
+			log.Println("Starting with caching disabled, reconnecting to Redis in the background")
+		}
+		cache = redisCache
+
+		// Локальный кеш в памяти перед Redis; LOCAL_CACHE_SIZE=0 отключает его
+		localSize := 10000
+		if v := os.Getenv("LOCAL_CACHE_SIZE"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				log.Fatalf("invalid LOCAL_CACHE_SIZE %q: must be a non-negative integer", v)
+			}
+			localSize = n
+		}
+		localTTL := 30 * time.Second
+		if v := os.Getenv("LOCAL_CACHE_TTL"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				log.Fatalf("invalid LOCAL_CACHE_TTL %q: must be a positive duration", v)
+			}
+			localTTL = d
+		}
+		if localSize > 0 {
+			tieredCache = storage.NewTieredCache(redisCache, redisCache.Redis().Client(), localSize, localTTL)
+			tieredCache.Channel = keyPrefix + storage.CacheInvalidationChannel
+			tieredCache.Codec = codec
+			cache = tieredCache
+			log.Printf("Using local cache for up to %d keys (TTL %v)", localSize, localTTL)
+		}
+	}
+
+	// Фактор IV: Backing services - необязательные реплики для чтения
+	readYourWritesWindow := 5 * time.Second
+	if v := os.Getenv("READ_YOUR_WRITES_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("invalid READ_YOUR_WRITES_WINDOW %q: must be a positive duration", v)
+		}
+		readYourWritesWindow = d
+	}
+
+	var replicas *storage.ReplicaSet
+	if urls := splitList(os.Getenv("DATABASE_REPLICA_URLS")); len(urls) > 0 {
+		if pgStore == nil {
+			log.Fatal("DATABASE_REPLICA_URLS is supported only with PostgreSQL and DATABASE_DRIVER=pq")
+		}
+		var err error
+		replicas, err = storage.NewReplicaSet(urls)
+		if err != nil {
+			log.Fatalf("could not open database replicas: %v", err)
+		}
+		defer replicas.Close()
+
+		if v := os.Getenv("DATABASE_REPLICA_MAX_LAG"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				log.Fatalf("invalid DATABASE_REPLICA_MAX_LAG %q: must be a positive duration", v)
+			}
+			replicas.MaxLag = d
+		}
+
+		replicasCtx, stopReplicas := context.WithCancel(context.Background())
+		defer stopReplicas()
+		go replicas.Run(replicasCtx)
+
+		if readYourWritesWindow < replicas.MaxLag {
+			log.Printf("READ_YOUR_WRITES_WINDOW %v is shorter than replica max lag %v: clients may not see their own writes",
+				readYourWritesWindow, replicas.MaxLag)
+		}
+
+		pgStore.Replicas = replicas
+		log.Printf("Routing reads to %d database replicas (max lag %v)", len(urls), replicas.MaxLag)
 	}
-	defer redisCache.Close()
 
-	// Создаем экземпляры наших зависимостей
-	userStore := storage.NewPostgresStore(db)
-	
 	// Оборачиваем store в кеширующий слой
-	cachedUserStore := storage.NewCachedUserStore(userStore, redisCache)
-	
+	cachedUserStore := storage.NewCachedUserStore(userStore, cache)
+	if replicas != nil {
+		cachedUserStore.ReplicaLagGrace = replicas.MaxLag
+	}
+	if v := os.Getenv("CACHE_TTL_JITTER"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f >= 1 {
+			log.Fatalf("invalid CACHE_TTL_JITTER %q: must be a number in [0, 1)", v)
+		}
+		cachedUserStore.TTLJitter = f
+	}
+	if v := os.Getenv("CACHE_NEGATIVE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("invalid CACHE_NEGATIVE_TTL %q: must be a non-negative duration", v)
+		}
+		cachedUserStore.NegativeTTL = d
+	}
+	if v := os.Getenv("CACHE_EARLY_REFRESH_BETA"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			log.Fatalf("invalid CACHE_EARLY_REFRESH_BETA %q: must be a non-negative number", v)
+		}
+		cachedUserStore.EarlyRefreshBeta = f
+	}
+	if v := os.Getenv("CACHE_LOAD_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("invalid CACHE_LOAD_TIMEOUT %q: must be a non-negative duration", v)
+		}
+		cachedUserStore.LoadTimeout = d
+	}
+
+	if redisCache != nil {
+		// Пока Redis был недоступен, изменения не сбрасывали кеш
+		redisCache.OnReconnect = cachedUserStore.InvalidateAll
+		redisCtx, stopRedis := context.WithCancel(context.Background())
+		defer stopRedis()
+		go redisCache.Run(redisCtx)
+		if tieredCache != nil {
+			go tieredCache.Run(redisCtx)
+		}
+	}
+
+	// Фоновый сброс кеша по уведомлениям PostgreSQL об изменениях users,
+	// в том числе сделанных в обход сервиса
+	if !storage.IsMemoryURL(connStr) && !storage.IsSQLiteURL(connStr) {
+		listenerCtx, stopListener := context.WithCancel(context.Background())
+		defer stopListener()
+		invalidationListener := storage.NewCacheInvalidationListener(connStr, cachedUserStore)
+		go invalidationListener.Run(listenerCtx)
+	}
+
 	userHandler := handlers.NewUserHandler(cachedUserStore)
+	// Требовать If-Match для изменяющих запросов (оптимистичная блокировка)
+	userHandler.RequireIfMatch = os.Getenv("REQUIRE_IF_MATCH") == "true"
+	userHandler.AdminToken = os.Getenv("ADMIN_TOKEN")
+	if retention := os.Getenv("USER_RETENTION_PERIOD"); retention != "" {
+		d, err := time.ParseDuration(retention)
+		if err != nil || d <= 0 {
+			log.Fatalf("invalid USER_RETENTION_PERIOD %q: must be a positive duration", retention)
+		}
+		userHandler.PurgeRetention = d
+	}
 
 	e := echo.New()
+	// Все ошибки, включая ошибки echo, возвращаются в формате application/problem+json
+	e.HTTPErrorHandler = handlers.HTTPErrorHandler
+	// Декларативная валидация тел запросов
+	e.Validator = handlers.NewValidator()
 
 	// Middleware
+	e.Use(middleware.RequestID())
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
+	e.Use(handlers.ActorMiddleware)
+	// X-Cache и Age в ответах, прочитанных через кеш
+	e.Use(handlers.CacheStatusMiddleware)
+	if replicas != nil {
+		e.Use(handlers.ReadYourWritesMiddleware(readYourWritesWindow))
+	}
 
 	// Routes
 	e.GET("/users", userHandler.GetUsers)
 	e.POST("/users", userHandler.CreateUser)
+	e.GET("/users/batch", userHandler.GetUsersByIDs)
 	e.GET("/users/:id", userHandler.GetUser)
 	e.PUT("/users/:id", userHandler.UpdateUser)
+	e.PATCH("/users/:id", userHandler.PatchUser)
 	e.DELETE("/users/:id", userHandler.DeleteUser)
+	e.POST("/users/:id/restore", userHandler.RestoreUser)
+	e.GET("/users/:id/history", userHandler.GetUserHistory)
+
+	// Административные операции
+	e.POST("/admin/users/purge", userHandler.PurgeDeletedUsers)
+	e.POST("/admin/users/import", userHandler.ImportUsers)
 
 	// Health check endpoint
-	e.GET("/health", func(c echo.Context) error {
-		return c.JSON(http.StatusOK, map[string]string{"status": "healthy"})
-	})
-
-	// Cache stats endpoint
-	e.GET("/cache/stats", func(c echo.Context) error {
-		// Простая проверка Redis
-		ctx := context.Background()
-		err := redisCache.Set(ctx, "test", "ping", time.Second)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"redis": "error",
-				"error": err.Error(),
-			})
-		}
-		
-		var result string
-		err = redisCache.Get(ctx, "test", &result)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"redis": "error",
-				"error": err.Error(),
-			})
-		}
+	e.GET("/health", handlers.HealthHandler(replicas, redisCache))
 
-		return c.JSON(http.StatusOK, map[string]string{
-			"redis": "healthy",
-			"test":  result,
-		})
-	})
+	// Cache stats endpoint: только для администратора, данные в Redis не изменяются
+	e.GET("/cache/stats", handlers.CacheStatsHandler(userHandler.AdminToken, cachedUserStore, tieredCache, redisCache))
 
 	port := os.Getenv("SERVER_PORT")
 	if port == "" {
 		port = "8080"
 	}
-	
+
 	// Фактор IX: Disposability - Graceful shutdown
 	go func() {
 		addr := fmt.Sprintf(":%s", port)
@@ -130,10 +325,21 @@ func main() {
 	// Graceful shutdown с таймаутом
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	
+
 	if err := e.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
-	
+
 	log.Println("Server exited")
 }
+
+// splitList разбирает список значений, разделенных запятыми, пропуская пустые.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
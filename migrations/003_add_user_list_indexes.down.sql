@@ -0,0 +1,7 @@
+-- Rollback: Remove user listing indexes
+-- Version: 003
+-- Description: Drop indexes used for keyset pagination and prefix filters
+
+DROP INDEX IF EXISTS idx_users_name_prefix;
+DROP INDEX IF EXISTS idx_users_email_prefix;
+DROP INDEX IF EXISTS idx_users_status_id;
@@ -0,0 +1,10 @@
+-- Migration: Add indexes for user listing
+-- Version: 003
+-- Description: Support keyset pagination with status and prefix filters
+
+-- Фильтр по статусу с постраничной выборкой по id
+CREATE INDEX IF NOT EXISTS idx_users_status_id ON users(status, id);
+
+-- Поиск по префиксу email и имени без учета регистра
+CREATE INDEX IF NOT EXISTS idx_users_email_prefix ON users(lower(email) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_users_name_prefix ON users(lower(name) text_pattern_ops);
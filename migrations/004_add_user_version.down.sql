@@ -0,0 +1,5 @@
+-- Rollback: Remove user version
+-- Version: 004
+-- Description: Remove version counter from users table
+
+ALTER TABLE users DROP COLUMN IF EXISTS version;
@@ -0,0 +1,6 @@
+-- Migration: Add user version
+-- Version: 004
+-- Description: Version counter for optimistic concurrency control (ETag / If-Match)
+
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS version INTEGER DEFAULT 1 NOT NULL;
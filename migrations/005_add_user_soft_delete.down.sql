@@ -0,0 +1,13 @@
+-- Rollback: Remove soft delete for users
+-- Version: 005
+-- Description: Drop deleted_at column and restore global email uniqueness
+
+-- Мягко удаленные пользователи удаляются окончательно, иначе восстановить
+-- уникальность email может быть невозможно
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS users_email_active_key;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+DROP INDEX IF EXISTS idx_users_deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
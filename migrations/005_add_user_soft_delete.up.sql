@@ -0,0 +1,13 @@
+-- Migration: Add soft delete for users
+-- Version: 005
+-- Description: deleted_at column; email uniqueness applies only to users that are not deleted
+
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+-- Поиск пользователей для окончательного удаления по истечении срока хранения
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Email удаленного пользователя можно использовать повторно
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_active_key ON users(email) WHERE deleted_at IS NULL;
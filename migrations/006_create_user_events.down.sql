@@ -0,0 +1,6 @@
+-- Rollback: Drop user events table
+-- Version: 006
+-- Description: Remove audit history of user changes
+
+DROP INDEX IF EXISTS idx_user_events_user_id;
+DROP TABLE IF EXISTS user_events;
@@ -0,0 +1,17 @@
+-- Migration: Create user events table
+-- Version: 006
+-- Description: Audit history of user changes (actor, operation, before/after diff)
+
+CREATE TABLE IF NOT EXISTS user_events (
+    id BIGSERIAL PRIMARY KEY,
+    -- Без внешнего ключа: история сохраняется и после окончательного удаления
+    user_id INTEGER NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    operation VARCHAR(20) NOT NULL,
+    before JSONB,
+    after JSONB,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+-- Постраничная выборка истории пользователя от новых событий к старым
+CREATE INDEX IF NOT EXISTS idx_user_events_user_id ON user_events(user_id, id DESC);
@@ -0,0 +1,6 @@
+-- Rollback: Drop outbox table
+-- Version: 007
+-- Description: Remove transactional outbox
+
+DROP INDEX IF EXISTS idx_outbox_unpublished;
+DROP TABLE IF EXISTS outbox;
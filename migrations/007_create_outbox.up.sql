@@ -0,0 +1,15 @@
+-- Migration: Create outbox table
+-- Version: 007
+-- Description: Transactional outbox for publishing user events to Redis Streams
+
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    published_at TIMESTAMP
+);
+
+-- Ретранслятор выбирает неопубликованные события в порядке записи
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox(id) WHERE published_at IS NULL;
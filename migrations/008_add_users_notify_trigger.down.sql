@@ -0,0 +1,7 @@
+-- Rollback: Remove users change notifications
+-- Version: 008
+-- Description: Drop NOTIFY triggers on users table
+
+DROP TRIGGER IF EXISTS users_truncated_notify ON users;
+DROP TRIGGER IF EXISTS users_changed_notify ON users;
+DROP FUNCTION IF EXISTS notify_users_changed();
@@ -0,0 +1,30 @@
+-- Migration: Notify about users changes
+-- Version: 008
+-- Description: Trigger emitting NOTIFY users_changed with the changed id for cache invalidation
+
+CREATE OR REPLACE FUNCTION notify_users_changed() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'TRUNCATE' THEN
+        -- '*' означает, что изменились все пользователи
+        PERFORM pg_notify('users_changed', '*');
+    ELSIF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('users_changed', OLD.id::text);
+    ELSE
+        PERFORM pg_notify('users_changed', NEW.id::text);
+        IF TG_OP = 'UPDATE' AND OLD.id <> NEW.id THEN
+            PERFORM pg_notify('users_changed', OLD.id::text);
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_changed_notify ON users;
+CREATE TRIGGER users_changed_notify
+    AFTER INSERT OR UPDATE OR DELETE ON users
+    FOR EACH ROW EXECUTE FUNCTION notify_users_changed();
+
+DROP TRIGGER IF EXISTS users_truncated_notify ON users;
+CREATE TRIGGER users_truncated_notify
+    AFTER TRUNCATE ON users
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_users_changed();
@@ -0,0 +1,5 @@
+-- Rollback: Drop published outbox index
+-- Version: 009
+-- Description: Remove index used to prune published outbox events
+
+DROP INDEX IF EXISTS idx_outbox_published;
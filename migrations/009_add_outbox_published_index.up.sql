@@ -0,0 +1,5 @@
+-- Migration: Index published outbox events
+-- Version: 009
+-- Description: Lets the relay prune published outbox events older than the retention period
+
+CREATE INDEX IF NOT EXISTS idx_outbox_published ON outbox(published_at) WHERE published_at IS NOT NULL;
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Операции, которые фиксируются в истории изменений пользователя.
+const (
+	OpCreate  = "create"
+	OpUpdate  = "update"
+	OpDelete  = "delete"
+	OpRestore = "restore"
+	OpPurge   = "purge"
+)
+
+// AnonymousActor — автор изменений, если он не указан в контексте.
+const AnonymousActor = "anonymous"
+
+type actorKey struct{}
+
+// WithActor возвращает контекст с автором изменений для аудита.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext возвращает автора изменений из контекста.
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return AnonymousActor
+}
+
+// UserEvent описывает одну запись истории изменений пользователя.
+// Before и After содержат только изменившиеся поля.
+type UserEvent struct {
+	ID        int             `json:"id"`
+	UserID    int             `json:"user_id"`
+	Actor     string          `json:"actor"`
+	Operation string          `json:"operation"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// HistoryOptions описывает параметры постраничной выборки истории.
+// События возвращаются от новых к старым.
+type HistoryOptions struct {
+	Cursor string
+	Limit  int
+}
+
+// Normalize подставляет значения по умолчанию и ограничивает размер страницы.
+func (o HistoryOptions) Normalize() HistoryOptions {
+	if o.Limit <= 0 {
+		o.Limit = DefaultPageSize
+	}
+	if o.Limit > MaxPageSize {
+		o.Limit = MaxPageSize
+	}
+	return o
+}
+
+// EventPage содержит одну страницу истории и курсор следующей страницы.
+type EventPage struct {
+	Events     []UserEvent `json:"events"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// auditFields возвращает поля пользователя, которые отслеживаются в истории.
+func auditFields(u *User) map[string]interface{} {
+	if u == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"name":       u.Name,
+		"email":      u.Email,
+		"status":     u.Status,
+		"deleted_at": u.DeletedAt,
+	}
+}
+
+// userDiff строит JSON-представления изменившихся полей до и после операции.
+// Для создания before пуст, для окончательного удаления пуст after.
+func userDiff(before, after *User) (json.RawMessage, json.RawMessage) {
+	b, a := auditFields(before), auditFields(after)
+	diffBefore := map[string]interface{}{}
+	diffAfter := map[string]interface{}{}
+	for field := range fieldsUnion(b, a) {
+		bv, bok := b[field]
+		av, aok := a[field]
+		bj, _ := json.Marshal(bv)
+		aj, _ := json.Marshal(av)
+		if bok && aok && string(bj) == string(aj) {
+			continue
+		}
+		if bok {
+			diffBefore[field] = bv
+		}
+		if aok {
+			diffAfter[field] = av
+		}
+	}
+	return marshalDiff(diffBefore), marshalDiff(diffAfter)
+}
+
+func fieldsUnion(maps ...map[string]interface{}) map[string]struct{} {
+	fields := map[string]struct{}{}
+	for _, m := range maps {
+		for k := range m {
+			fields[k] = struct{}{}
+		}
+	}
+	return fields
+}
+
+func marshalDiff(diff map[string]interface{}) json.RawMessage {
+	if len(diff) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(diff)
+	return data
+}
+
+// nullJSON превращает пустой JSON в NULL для записи в JSONB.
+func nullJSON(data json.RawMessage) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return []byte(data)
+}
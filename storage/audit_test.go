@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestUserDiff(t *testing.T) {
+	ann := &User{ID: 1, Name: "Ann", Email: "ann@example.com", Status: "active", Version: 1}
+	renamed := *ann
+	renamed.Name = "Annie"
+	renamed.Version = 2
+
+	tests := []struct {
+		name          string
+		before, after *User
+		// wantBefore и wantAfter — ожидаемые поля; nil — пустой JSON.
+		wantBefore, wantAfter map[string]interface{}
+	}{
+		{
+			name:      "create",
+			after:     ann,
+			wantAfter: map[string]interface{}{"name": "Ann", "email": "ann@example.com", "status": "active", "deleted_at": nil},
+		},
+		{
+			name:       "only changed fields",
+			before:     ann,
+			after:      &renamed,
+			wantBefore: map[string]interface{}{"name": "Ann"},
+			wantAfter:  map[string]interface{}{"name": "Annie"},
+		},
+		{
+			name:   "version alone is not a change",
+			before: ann,
+			after:  &User{ID: 1, Name: "Ann", Email: "ann@example.com", Status: "active", Version: 5},
+		},
+		{
+			name:   "no change",
+			before: ann,
+			after:  ann,
+		},
+		{
+			name:       "purge",
+			before:     ann,
+			wantBefore: map[string]interface{}{"name": "Ann", "email": "ann@example.com", "status": "active", "deleted_at": nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after := userDiff(tt.before, tt.after)
+			expectDiff(t, "before", before, tt.wantBefore)
+			expectDiff(t, "after", after, tt.wantAfter)
+		})
+	}
+}
+
+// expectDiff сравнивает JSON-представление изменений с ожидаемыми полями.
+func expectDiff(t *testing.T, side string, got json.RawMessage, want map[string]interface{}) {
+	t.Helper()
+	if want == nil {
+		if got != nil {
+			t.Errorf("%s = %s, want nil", side, got)
+		}
+		return
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(got, &fields); err != nil {
+		t.Fatalf("%s = %s: %v", side, got, err)
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("%s = %s, want %v", side, got, want)
+	}
+}
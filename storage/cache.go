@@ -2,15 +2,21 @@ package storage
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-// CacheService определяет интерфейс для работы с кешем
+// ErrCacheMiss возвращается Get, если ключа нет в кеше.
+var ErrCacheMiss = errors.New("key not found")
+
+// CacheService определяет интерфейс для работы с кешем.
+// Get возвращает ErrCacheMiss, если ключа нет в кеше.
 type CacheService interface {
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
 	Get(ctx context.Context, key string, dest interface{}) error
@@ -18,9 +24,31 @@ type CacheService interface {
 	DeletePattern(ctx context.Context, pattern string) error
 }
 
-// RedisCache реализует CacheService с использованием Redis
+// NamespaceInvalidator — необязательный интерфейс CacheService для сброса
+// всех ключей пространства имен одной операцией. Пространство имен ключа —
+// его часть до последнего двоеточия: "user" для "user:1".
+type NamespaceInvalidator interface {
+	InvalidateNamespace(ctx context.Context, namespace string) error
+}
+
+// scanCount — сколько ключей Redis просматривает за один SCAN.
+const scanCount = 500
+
+// RedisCache реализует CacheService с использованием Redis.
+//
+// Ключи с пространством имен хранятся в Redis как
+// "{Prefix}{{namespace}}:v{поколение}:{id}", а поколение пространства —
+// в ключе "{Prefix}{{namespace}}:gen". Пространство имен в фигурных скобках —
+// hash tag Redis Cluster, поэтому ключи пространства и его поколение лежат
+// в одном слоте. InvalidateNamespace увеличивает поколение, и все прежние
+// ключи пространства перестают читаться, а затем истекают по TTL.
 type RedisCache struct {
 	client *redis.Client
+	// Codec кодирует значения; nil — DefaultCodec (JSON без сжатия).
+	Codec *Codec
+	// Prefix добавляется ко всем ключам, чтобы несколько приложений
+	// и окружений могли делить один Redis, например "users:production:".
+	Prefix string
 }
 
 // NewRedisCache создает новый экземпляр RedisCache
@@ -46,12 +74,21 @@ func NewRedisCache(redisURL string) (*RedisCache, error) {
 
 // Set сохраняет значение в кеше
 func (r *RedisCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	data, err := json.Marshal(value)
-	if err != nil {
-		return fmt.Errorf("failed to marshal value: %w", err)
+	var err error
+	data, ok := value.(EncodedValue)
+	if !ok {
+		if data, err = r.codec().Encode(value); err != nil {
+			return err
+		}
 	}
 
-	err = r.client.Set(ctx, key, data, expiration).Err()
+	// go-redis передает []byte как есть, а именованный EncodedValue
+	// отклоняет, поэтому значение приводится к []byte
+	if expiration > 0 {
+		err = r.run(ctx, "SET", key, []byte(data), "PX", expiration.Milliseconds()).Err()
+	} else {
+		err = r.run(ctx, "SET", key, []byte(data)).Err()
+	}
 	if err != nil {
 		log.Printf("Error setting cache key %s: %v", key, err)
 		return err
@@ -63,17 +100,24 @@ func (r *RedisCache) Set(ctx context.Context, key string, value interface{}, exp
 
 // Get получает значение из кеша
 func (r *RedisCache) Get(ctx context.Context, key string, dest interface{}) error {
-	data, err := r.client.Get(ctx, key).Result()
+	text, err := r.run(ctx, "GET", key).Text()
 	if err != nil {
 		if err == redis.Nil {
 			log.Printf("Cache miss: %s", key)
-			return fmt.Errorf("key not found")
+			return ErrCacheMiss
 		}
 		log.Printf("Error getting cache key %s: %v", key, err)
 		return err
 	}
 
-	err = json.Unmarshal([]byte(data), dest)
+	data := []byte(text)
+	if raw, ok := dest.(*EncodedValue); ok {
+		*raw = data
+		log.Printf("Cache hit: %s", key)
+		return nil
+	}
+
+	err = r.codec().Decode(data, dest)
 	if err != nil {
 		log.Printf("Error unmarshaling cache data for key %s: %v", key, err)
 		return fmt.Errorf("failed to unmarshal cached data: %w", err)
@@ -85,7 +129,7 @@ func (r *RedisCache) Get(ctx context.Context, key string, dest interface{}) erro
 
 // Delete удаляет ключ из кеша
 func (r *RedisCache) Delete(ctx context.Context, key string) error {
-	err := r.client.Del(ctx, key).Err()
+	err := r.run(ctx, "UNLINK", key).Err()
 	if err != nil {
 		log.Printf("Error deleting cache key %s: %v", key, err)
 		return err
@@ -95,27 +139,203 @@ func (r *RedisCache) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
-// DeletePattern удаляет все ключи по паттерну
+// DeletePattern удаляет все ключи по glob-шаблону. Ключи перебираются
+// курсором SCAN, поэтому Redis не блокируется на время обхода, и удаляются
+// UNLINK, освобождающим память в фоне.
 func (r *RedisCache) DeletePattern(ctx context.Context, pattern string) error {
-	keys, err := r.client.Keys(ctx, pattern).Result()
-	if err != nil {
-		log.Printf("Error finding keys with pattern %s: %v", pattern, err)
-		return err
+	// Поколение вставляется после пространства имен, поэтому в SCAN можно
+	// передать только неизменную часть шаблона до последнего двоеточия,
+	// а остальное проверить по ключу без поколения
+	match := escapePattern(r.Prefix) + "*"
+	if namespace := patternNamespace(pattern); namespace != "" {
+		match = escapePattern(r.Prefix) + "{" + escapePattern(strings.TrimSuffix(namespace, ":")) + "*"
 	}
 
-	if len(keys) > 0 {
-		err = r.client.Del(ctx, keys...).Err()
+	deleted := 0
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, match, scanCount).Result()
 		if err != nil {
-			log.Printf("Error deleting keys with pattern %s: %v", pattern, err)
+			log.Printf("Error scanning keys with pattern %s: %v", pattern, err)
 			return err
 		}
-		log.Printf("Cache deleted %d keys with pattern: %s", len(keys), pattern)
+
+		matched := keys[:0]
+		for _, k := range keys {
+			if key, ok := r.logicalKey(k); ok && matchPattern(pattern, key) {
+				matched = append(matched, k)
+			}
+		}
+		if len(matched) > 0 {
+			if err := r.client.Unlink(ctx, matched...).Err(); err != nil {
+				log.Printf("Error deleting keys with pattern %s: %v", pattern, err)
+				return err
+			}
+			deleted += len(matched)
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
 	}
 
+	if deleted > 0 {
+		log.Printf("Cache deleted %d keys with pattern: %s", deleted, pattern)
+	}
+	return nil
+}
+
+// codec возвращает кодек значений.
+func (r *RedisCache) codec() *Codec {
+	if r.Codec != nil {
+		return r.Codec
+	}
+	return DefaultCodec
+}
+
+// InvalidateNamespace сбрасывает все ключи пространства имен, увеличивая
+// его поколение.
+func (r *RedisCache) InvalidateNamespace(ctx context.Context, namespace string) error {
+	gen, err := r.client.Incr(ctx, r.namespaceKey(namespace)+":gen").Result()
+	if err != nil {
+		log.Printf("Error invalidating cache namespace %s: %v", namespace, err)
+		return err
+	}
+
+	log.Printf("Cache namespace %s invalidated (generation %d)", namespace, gen)
 	return nil
 }
 
+// run выполняет команду над ключем key с учетом префикса и поколения его
+// пространства имен. Поколение читается отдельным запросом: ключ, с которым
+// работает команда, должен быть известен Redis Cluster заранее. Если
+// пространство сбрасывается между запросами, команда затрагивает ключ
+// прежнего поколения, который больше не читается.
+func (r *RedisCache) run(ctx context.Context, command, key string, args ...interface{}) *redis.Cmd {
+	i := strings.LastIndexByte(key, ':')
+	if i < 0 {
+		return r.client.Do(ctx, append([]interface{}{command, r.Prefix + key}, args...)...)
+	}
+	namespace, id := r.namespaceKey(key[:i]), key[i+1:]
+
+	gen, err := r.client.Get(ctx, namespace+":gen").Result()
+	if err == redis.Nil {
+		gen, err = "0", nil
+	}
+	if err != nil {
+		cmd := redis.NewCmd(ctx, command, r.Prefix+key)
+		cmd.SetErr(err)
+		return cmd
+	}
+	return r.client.Do(ctx, append([]interface{}{command, namespace + ":v" + gen + ":" + id}, args...)...)
+}
+
+// namespaceKey возвращает начало ключей пространства имен в Redis: префикс
+// и пространство в фигурных скобках.
+func (r *RedisCache) namespaceKey(namespace string) string {
+	return r.Prefix + "{" + namespace + "}"
+}
+
+// logicalKey восстанавливает ключ без префикса и поколения по ключу в Redis.
+// Для ключей поколений и чужих ключей возвращает false.
+func (r *RedisCache) logicalKey(stored string) (string, bool) {
+	key, ok := strings.CutPrefix(stored, r.Prefix)
+	if !ok {
+		return "", false
+	}
+	i := strings.LastIndexByte(key, ':')
+	if i < 0 {
+		return key, true
+	}
+	head, id := key[:i], key[i+1:]
+	j := strings.LastIndex(head, "}:v")
+	if j < 0 || !strings.HasPrefix(head, "{") {
+		return "", false
+	}
+	if _, err := strconv.ParseUint(head[j+3:], 10, 64); err != nil {
+		return "", false
+	}
+	return head[1:j] + ":" + id, true
+}
+
+// patternNamespace возвращает начало шаблона без спецсимволов до последнего
+// двоеточия включительно.
+func patternNamespace(pattern string) string {
+	literal := pattern
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		literal = pattern[:i]
+	}
+	return literal[:strings.LastIndexByte(literal, ':')+1]
+}
+
+// escapePattern экранирует спецсимволы glob-шаблона Redis.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]\`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// Info возвращает разделы INFO Redis в виде поле → значение по разделам,
+// например info["memory"]["used_memory_human"].
+func (r *RedisCache) Info(ctx context.Context, sections ...string) (map[string]map[string]string, error) {
+	text, err := r.client.Info(ctx, sections...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	info := make(map[string]map[string]string)
+	var section map[string]string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if name, ok := strings.CutPrefix(line, "# "); ok {
+			section = make(map[string]string)
+			info[strings.ToLower(name)] = section
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok && section != nil {
+			section[key] = value
+		}
+	}
+	return info, nil
+}
+
+// RedisPoolStats — состояние пула соединений клиента Redis.
+type RedisPoolStats struct {
+	// Hits и Misses — сколько раз соединение нашлось или не нашлось в пуле.
+	Hits     uint32 `json:"hits"`
+	Misses   uint32 `json:"misses"`
+	Timeouts uint32 `json:"timeouts"`
+	// TotalConns и IdleConns — открытые и простаивающие соединения.
+	TotalConns uint32 `json:"total_conns"`
+	IdleConns  uint32 `json:"idle_conns"`
+	StaleConns uint32 `json:"stale_conns"`
+}
+
+// PoolStats возвращает состояние пула соединений.
+func (r *RedisCache) PoolStats() RedisPoolStats {
+	stats := r.client.PoolStats()
+	return RedisPoolStats{
+		Hits:       stats.Hits,
+		Misses:     stats.Misses,
+		Timeouts:   stats.Timeouts,
+		TotalConns: stats.TotalConns,
+		IdleConns:  stats.IdleConns,
+		StaleConns: stats.StaleConns,
+	}
+}
+
+// Client возвращает клиент Redis, например для pub/sub.
+func (r *RedisCache) Client() *redis.Client {
+	return r.client
+}
+
 // Close закрывает соединение с Redis
 func (r *RedisCache) Close() error {
 	return r.client.Close()
-} 
\ No newline at end of file
+}
@@ -0,0 +1,92 @@
+package storage
+
+import "testing"
+
+func TestRedisCacheLogicalKey(t *testing.T) {
+	r := &RedisCache{Prefix: "app:"}
+	tests := []struct {
+		stored string
+		want   string
+		ok     bool
+	}{
+		{"app:{user}:v3:42", "user:42", true},
+		{"app:{users:list}:v0:abc", "users:list:abc", true},
+		{"app:{user}:v12:v1", "user:v1", true},
+		{"app:plain", "plain", true},
+		{"app:{user}:gen", "", false},
+		{"app:{user}:v1", "", false},
+		{"app:{user}:vx:1", "", false},
+		{"app:{user}:v-1:1", "", false},
+		{"app:user:v1:1", "", false},
+		{"other:{user}:v1:1", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := r.logicalKey(tt.stored)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("logicalKey(%q) = %q, %v; want %q, %v", tt.stored, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRedisCacheLogicalKeyWithoutPrefix(t *testing.T) {
+	r := &RedisCache{}
+	if got, ok := r.logicalKey("{user}:v1:7"); got != "user:7" || !ok {
+		t.Errorf("logicalKey({user}:v1:7) = %q, %v; want user:7, true", got, ok)
+	}
+}
+
+func TestPatternNamespace(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"user:*", "user:"},
+		{"user:1", "user:"},
+		{"users:list:*", "users:list:"},
+		{"users:li[sx]t:*", "users:"},
+		{"users:*:page", "users:"},
+		{"us?r:*", ""},
+		{`user\:*`, ""},
+		{"*", ""},
+		{"plain", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := patternNamespace(tt.pattern); got != tt.want {
+			t.Errorf("patternNamespace(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestEscapePattern(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"users:production:", "users:production:"},
+		{"", ""},
+		{"a*b?c", `a\*b\?c`},
+		{"[x]", `\[x\]`},
+		{`back\slash`, `back\\slash`},
+		{"ключ*", `ключ\*`},
+	}
+	for _, tt := range tests {
+		if got := escapePattern(tt.in); got != tt.want {
+			t.Errorf("escapePattern(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// Экранированный префикс со спецсимволами совпадает в SCAN только сам с собой.
+func TestEscapePatternMatchesPrefixLiterally(t *testing.T) {
+	prefix := "app[1]*:"
+	match := escapePattern(prefix) + "{user*"
+	if !matchPattern(match, "app[1]*:{user}:v2:5") {
+		t.Errorf("%q does not match a key with prefix %q", match, prefix)
+	}
+	for _, key := range []string{"app1x:{user}:v2:5", "app[1]x:{user}:v2:5"} {
+		if matchPattern(match, key) {
+			t.Errorf("%q matches %q, want only prefix %q", match, key, prefix)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// cacheRecorderKey — ключ CacheRecorder в контексте запроса.
+type cacheRecorderKey struct{}
+
+// CacheRecorder собирает результаты обращений CachedUserStore к кешу за время
+// одного запроса, чтобы их можно было показать клиенту.
+type CacheRecorder struct {
+	mu       sync.Mutex
+	recorded bool
+	hit      bool
+	// writtenAt — время записи самого старого из прочитанных значений.
+	writtenAt time.Time
+}
+
+// WithCacheRecorder возвращает контекст с новым CacheRecorder.
+func WithCacheRecorder(ctx context.Context) (context.Context, *CacheRecorder) {
+	r := &CacheRecorder{}
+	return context.WithValue(ctx, cacheRecorderKey{}, r), r
+}
+
+// Result возвращает итог обращений к кешу: hit — все чтения попали в кеш,
+// age — возраст самого старого значения. ok равно false, если кеш не
+// использовался.
+func (r *CacheRecorder) Result() (hit bool, age time.Duration, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.recorded {
+		return false, 0, false
+	}
+	if r.hit {
+		age = time.Since(r.writtenAt)
+	}
+	return r.hit, age, true
+}
+
+// recordCacheResult добавляет результат чтения в CacheRecorder из контекста.
+func recordCacheResult(ctx context.Context, hit bool, writtenAt time.Time) {
+	r, ok := ctx.Value(cacheRecorderKey{}).(*CacheRecorder)
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.recorded {
+		r.recorded, r.hit, r.writtenAt = true, hit, writtenAt
+		return
+	}
+	r.hit = r.hit && hit
+	if writtenAt.Before(r.writtenAt) {
+		r.writtenAt = writtenAt
+	}
+}
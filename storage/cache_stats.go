@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cacheStats считает обращения к кешу отдельно для каждого пространства имен
+// ключей (части ключа до последнего двоеточия).
+type cacheStats struct {
+	mu         sync.RWMutex
+	namespaces map[string]*namespaceStats
+}
+
+// namespaceStats — счетчики одного пространства имен.
+type namespaceStats struct {
+	hits, misses, errors, sets, invalidations atomic.Int64
+	// ops, latency и maxLatency — число, суммарная и наибольшая
+	// длительность операций с кешем.
+	ops, latency, maxLatency atomic.Int64
+}
+
+// CacheNamespaceStats — снимок статистики пространства имен ключей кеша.
+type CacheNamespaceStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// HitRatio — доля попаданий среди чтений.
+	HitRatio float64 `json:"hit_ratio"`
+	Errors   int64   `json:"errors"`
+	Sets     int64   `json:"sets"`
+	// Invalidations — ключи и пространства имен, сброшенные при изменениях.
+	// Вытеснения самим Redis не учитываются, см. evicted_keys в INFO.
+	Invalidations int64   `json:"invalidations"`
+	AvgLatencyMs  float64 `json:"avg_latency_ms"`
+	MaxLatencyMs  float64 `json:"max_latency_ms"`
+}
+
+func newCacheStats() *cacheStats {
+	return &cacheStats{namespaces: make(map[string]*namespaceStats)}
+}
+
+// keyNamespace возвращает пространство имен ключа.
+func keyNamespace(key string) string {
+	if i := strings.LastIndexByte(key, ':'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// namespace возвращает счетчики пространства имен, создавая их при первом
+// обращении.
+func (s *cacheStats) namespace(name string) *namespaceStats {
+	s.mu.RLock()
+	ns, ok := s.namespaces[name]
+	s.mu.RUnlock()
+	if ok {
+		return ns
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ns, ok = s.namespaces[name]; !ok {
+		ns = &namespaceStats{}
+		s.namespaces[name] = ns
+	}
+	return ns
+}
+
+// observe учитывает длительность операции с кешем, начатой в started.
+func (ns *namespaceStats) observe(started time.Time) {
+	d := int64(time.Since(started))
+	ns.ops.Add(1)
+	ns.latency.Add(d)
+	for {
+		max := ns.maxLatency.Load()
+		if d <= max || ns.maxLatency.CompareAndSwap(max, d) {
+			return
+		}
+	}
+}
+
+// snapshot возвращает текущие значения счетчиков по пространствам имен.
+func (s *cacheStats) snapshot() map[string]CacheNamespaceStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]CacheNamespaceStats, len(s.namespaces))
+	for name, ns := range s.namespaces {
+		snap := CacheNamespaceStats{
+			Hits:          ns.hits.Load(),
+			Misses:        ns.misses.Load(),
+			Errors:        ns.errors.Load(),
+			Sets:          ns.sets.Load(),
+			Invalidations: ns.invalidations.Load(),
+			MaxLatencyMs:  float64(ns.maxLatency.Load()) / float64(time.Millisecond),
+		}
+		if reads := snap.Hits + snap.Misses; reads > 0 {
+			snap.HitRatio = float64(snap.Hits) / float64(reads)
+		}
+		if ops := ns.ops.Load(); ops > 0 {
+			snap.AvgLatencyMs = float64(ns.latency.Load()) / float64(ops) / float64(time.Millisecond)
+		}
+		result[name] = snap
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/avetis74/12_app_factors/storage"
+)
+
+// failingCache отклоняет все операции с кешем.
+type failingCache struct{}
+
+var errCacheDown = errors.New("cache is down")
+
+func (failingCache) Set(context.Context, string, interface{}, time.Duration) error {
+	return errCacheDown
+}
+
+func (failingCache) Get(context.Context, string, interface{}) error { return errCacheDown }
+
+func (failingCache) Delete(context.Context, string) error { return errCacheDown }
+
+func (failingCache) DeletePattern(context.Context, string) error { return errCacheDown }
+
+// counters — счетчики пространства имен без задержек и доли попаданий.
+type counters struct {
+	hits, misses, errors, sets, invalidations int64
+}
+
+// expectCounters сравнивает счетчики статистики с ожидаемыми.
+func expectCounters(t *testing.T, stats map[string]storage.CacheNamespaceStats, want map[string]counters) {
+	t.Helper()
+	for namespace, w := range want {
+		s, ok := stats[namespace]
+		if !ok {
+			t.Errorf("no stats for namespace %s", namespace)
+			continue
+		}
+		got := counters{s.Hits, s.Misses, s.Errors, s.Sets, s.Invalidations}
+		if got != w {
+			t.Errorf("Stats()[%s] = %+v, want %+v", namespace, got, w)
+		}
+		if s.AvgLatencyMs <= 0 || s.MaxLatencyMs < s.AvgLatencyMs {
+			t.Errorf("Stats()[%s] latency avg %v ms, max %v ms; want 0 < avg <= max",
+				namespace, s.AvgLatencyMs, s.MaxLatencyMs)
+		}
+	}
+	for namespace := range stats {
+		if _, ok := want[namespace]; !ok {
+			t.Errorf("unexpected stats for namespace %s", namespace)
+		}
+	}
+}
+
+func TestCachedUserStoreStats(t *testing.T) {
+	ctx := context.Background()
+	cached := storage.NewCachedUserStore(storage.NewMemoryStore(), storage.NewMemoryCache())
+	cached.EarlyRefreshBeta = 0
+
+	// Создание сбрасывает страницы списка и ключ пользователя, затем
+	// кеширует нового пользователя
+	user := &storage.User{Name: "Ann", Email: "ann@example.com", Status: "active"}
+	if err := cached.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.GetUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	// Промах с кешированием отсутствия
+	if _, err := cached.GetUser(ctx, 999); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetUser(999): err = %v, want ErrNotFound", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := cached.ListUsers(ctx, storage.ListOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changed := &storage.User{Name: "Annie", Email: user.Email, Status: user.Status}
+	if err := cached.UpdateUser(ctx, user.ID, changed); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := cached.Stats()
+	expectCounters(t, stats, map[string]counters{
+		"user":       {hits: 1, misses: 1, sets: 2, invalidations: 2},
+		"users:list": {hits: 2, misses: 1, sets: 1, invalidations: 2},
+	})
+	if ratio := stats["users:list"].HitRatio; ratio < 0.66 || ratio > 0.67 {
+		t.Errorf("Stats()[users:list].HitRatio = %v, want 2/3", ratio)
+	}
+}
+
+func TestCachedUserStoreStatsCountErrors(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	user := &storage.User{Name: "Ann", Email: "ann@example.com", Status: "active"}
+	if err := store.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	cached := storage.NewCachedUserStore(store, failingCache{})
+
+	// Ошибки кеша не мешают чтению из хранилища, но учитываются: чтение
+	// считается промахом с ошибкой, запись загруженного значения — ошибкой
+	if got, err := cached.GetUser(ctx, user.ID); err != nil || got.Name != "Ann" {
+		t.Fatalf("GetUser() = %+v, %v; want Ann from the store", got, err)
+	}
+	if err := cached.DeleteUser(ctx, user.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	expectCounters(t, cached.Stats(), map[string]counters{
+		"user":       {misses: 1, errors: 3},
+		"users:list": {errors: 1},
+	})
+}
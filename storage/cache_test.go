@@ -0,0 +1,127 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/avetis74/12_app_factors/storage/storagetest"
+)
+
+// testRedisURL возвращает адрес тестового Redis или пропускает тест, если
+// TEST_REDIS_URL не задан.
+func testRedisURL(t *testing.T) string {
+	t.Helper()
+	url := os.Getenv("TEST_REDIS_URL")
+	if url == "" {
+		t.Skip("TEST_REDIS_URL is not set")
+	}
+	return url
+}
+
+// openTestRedis подключается к тестовому Redis.
+func openTestRedis(t *testing.T) *storage.RedisCache {
+	t.Helper()
+	cache, err := storage.NewRedisCache(testRedisURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	return cache
+}
+
+func TestRedisCache(t *testing.T) {
+	cache := openTestRedis(t)
+	storagetest.TestCacheService(t, func(t *testing.T) storage.CacheService {
+		return cache
+	})
+}
+
+func TestRedisCacheCodec(t *testing.T) {
+	codec, err := storage.NewCodec("msgpack", "zstd", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := openTestRedis(t)
+	cache.Codec = codec
+	cache.Prefix = "storagetest:codec:"
+	storagetest.TestCacheService(t, func(t *testing.T) storage.CacheService {
+		return cache
+	})
+}
+
+func TestReconnectingCache(t *testing.T) {
+	cache, err := storage.NewReconnectingCache(testRedisURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	if err := cache.Check(context.Background()); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	storagetest.TestCacheService(t, func(t *testing.T) storage.CacheService {
+		return cache
+	})
+}
+
+// newTestTieredCache создает TieredCache поверх тестового Redis и получает
+// сообщения об удалении ключей до завершения теста. localTTL — срок жизни
+// локального уровня.
+func newTestTieredCache(t *testing.T, channel string, localTTL time.Duration) *storage.TieredCache {
+	t.Helper()
+	remote := openTestRedis(t)
+	tiered := storage.NewTieredCache(remote, remote.Client(), 100, localTTL)
+	tiered.Channel = channel
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go tiered.Run(ctx)
+	return tiered
+}
+
+func TestTieredCache(t *testing.T) {
+	testRedisURL(t)
+	// Копия, прочитанная из Redis, живет до истечения локального срока
+	// независимо от срока ключа в Redis, поэтому он меньше сроков в проверках
+	storagetest.TestCacheService(t, func(t *testing.T) storage.CacheService {
+		return newTestTieredCache(t, "storagetest:"+t.Name(), 50*time.Millisecond)
+	})
+}
+
+func TestTieredCacheInvalidatesOtherInstances(t *testing.T) {
+	ctx := context.Background()
+	channel := "storagetest:" + t.Name()
+	a := newTestTieredCache(t, channel, time.Minute)
+	b := newTestTieredCache(t, channel, time.Minute)
+	key := "storagetest:tiered:" + time.Now().Format(time.RFC3339Nano)
+
+	// Ждем подписки обоих экземпляров: сообщения до нее теряются
+	time.Sleep(100 * time.Millisecond)
+
+	if err := a.Set(ctx, key, "v1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	if err := b.Get(ctx, key, &got); err != nil || got != "v1" {
+		t.Fatalf("b.Get() = %q, %v; want v1", got, err)
+	}
+	if err := a.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	// b хранит значение локально, пока не получит сообщение об удалении
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		err := b.Get(ctx, key, &got)
+		if errors.Is(err, storage.ErrCacheMiss) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("b.Get() after delete = %q, %v; want ErrCacheMiss", got, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -2,99 +2,150 @@ package storage
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"math/rand/v2"
+	"os"
 	"time"
 )
 
+// Пространства имен ключей кеша: страницы списка и отдельные пользователи.
+const (
+	listCacheNamespace = "users:list"
+	userCacheNamespace = "user"
+)
+
+// Сроки жизни ключей кеша до случайного сдвига TTLJitter.
+const (
+	listCacheTTL = 5 * time.Minute
+	userCacheTTL = 10 * time.Minute
+)
+
+// userCacheKey возвращает ключ кеша для одного пользователя.
+func userCacheKey(id int) string {
+	return fmt.Sprintf("%s:%d", userCacheNamespace, id)
+}
+
+// listCacheKey возвращает ключ кеша для страницы списка с заданными параметрами.
+func listCacheKey(opts ListOptions) string {
+	data, _ := json.Marshal(opts)
+	sum := sha1.Sum(data)
+	return listCacheNamespace + ":" + hex.EncodeToString(sum[:])
+}
+
 // CachedUserStore обертка над UserStore с кешированием
 type CachedUserStore struct {
 	store UserStore
 	cache CacheService
+	// loads объединяет одновременные загрузки одного ключа из хранилища
+	loads loadGroup
+	stats *cacheStats
+
+	// EarlyRefreshBeta управляет вероятностным ранним обновлением (XFetch):
+	// чем больше значение, тем раньше до истечения TTL один из запросов
+	// перезагружает ключ в фоне. 0 отключает раннее обновление.
+	EarlyRefreshBeta float64
+	// Source — имя экземпляра, которое сохраняется в записях кеша
+	// (по умолчанию имя хоста).
+	Source string
+	// NegativeTTL — срок хранения в кеше результата "пользователь не найден".
+	// 0 отключает кеширование отсутствия.
+	NegativeTTL time.Duration
+	// TTLJitter — доля TTL, на которую случайно сдвигается срок жизни ключа,
+	// чтобы ключи, записанные одновременно, не истекали одновременно.
+	TTLJitter float64
+	// ReplicaLagGrace — если чтение идет с реплик, кеш сбрасывается повторно
+	// через это время после записи: иначе значение, прочитанное с отстающей
+	// реплики сразу после сброса, оставалось бы в кеше до истечения TTL.
+	ReplicaLagGrace time.Duration
+	// LoadTimeout ограничивает загрузку значения из хранилища при промахе.
+	// Загрузка не отменяется вместе с одним запросом, поэтому без срока
+	// зависший запрос к БД удерживал бы соединение бесконечно.
+	LoadTimeout time.Duration
 }
 
 // NewCachedUserStore создает новый кешированный UserStore
 func NewCachedUserStore(store UserStore, cache CacheService) *CachedUserStore {
+	source, _ := os.Hostname()
 	return &CachedUserStore{
-		store: store,
-		cache: cache,
+		store:            store,
+		cache:            cache,
+		stats:            newCacheStats(),
+		EarlyRefreshBeta: 1,
+		NegativeTTL:      30 * time.Second,
+		Source:           source,
+		TTLJitter:        0.1,
+		LoadTimeout:      10 * time.Second,
 	}
 }
 
-// GetUsers возвращает всех пользователей с кешированием
-func (c *CachedUserStore) GetUsers() ([]User, error) {
-	ctx := context.Background()
-	cacheKey := "users:all"
-	
-	// Пытаемся получить из кеша
-	var users []User
-	err := c.cache.Get(ctx, cacheKey, &users)
-	if err == nil {
-		log.Println("Returning users from cache")
-		return users, nil
-	}
-
-	// Если не найдено в кеше, получаем из БД
-	log.Println("Cache miss, fetching users from database")
-	users, err = c.store.GetUsers()
-	if err != nil {
-		return nil, err
+// cacheAvailable сообщает, можно ли обращаться к кешу. Пока кеш недоступен,
+// CachedUserStore работает напрямую с хранилищем.
+func (c *CachedUserStore) cacheAvailable() bool {
+	if health, ok := c.cache.(CacheHealth); ok {
+		return health.Available()
 	}
+	return true
+}
 
-	// Сохраняем в кеш на 5 минут
-	if cacheErr := c.cache.Set(ctx, cacheKey, users, 5*time.Minute); cacheErr != nil {
-		log.Printf("Failed to cache users: %v", cacheErr)
+// ListUsers возвращает страницу пользователей с кешированием.
+// Каждая комбинация фильтров, сортировки и курсора кешируется отдельно.
+func (c *CachedUserStore) ListUsers(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	opts = opts.Normalize()
+	if !c.cacheAvailable() {
+		recordCacheResult(ctx, false, time.Time{})
+		return c.store.ListUsers(ctx, opts)
 	}
+	cacheKey := listCacheKey(opts)
 
-	return users, nil
+	return fetch(c, ctx, cacheKey, listCacheTTL, func(ctx context.Context) (*UserPage, error) {
+		return c.store.ListUsers(ctx, opts)
+	})
 }
 
 // GetUser возвращает пользователя по ID с кешированием
-func (c *CachedUserStore) GetUser(id int) (*User, error) {
-	ctx := context.Background()
-	cacheKey := fmt.Sprintf("user:%d", id)
-	
-	// Пытаемся получить из кеша
-	var user User
-	err := c.cache.Get(ctx, cacheKey, &user)
-	if err == nil {
-		log.Printf("Returning user %d from cache", id)
-		return &user, nil
+func (c *CachedUserStore) GetUser(ctx context.Context, id int) (*User, error) {
+	if !c.cacheAvailable() {
+		recordCacheResult(ctx, false, time.Time{})
+		return c.store.GetUser(ctx, id)
 	}
+	cacheKey := userCacheKey(id)
 
-	// Если не найдено в кеше, получаем из БД
-	log.Printf("Cache miss, fetching user %d from database", id)
-	userPtr, err := c.store.GetUser(id)
-	if err != nil {
-		return nil, err
-	}
-
-	// Сохраняем в кеш на 10 минут
-	if cacheErr := c.cache.Set(ctx, cacheKey, *userPtr, 10*time.Minute); cacheErr != nil {
-		log.Printf("Failed to cache user %d: %v", id, cacheErr)
-	}
-
-	return userPtr, nil
+	return fetch(c, ctx, cacheKey, userCacheTTL, func(ctx context.Context) (*User, error) {
+		return c.store.GetUser(ctx, id)
+	})
 }
 
 // CreateUser создает пользователя и сбрасывает кеш
-func (c *CachedUserStore) CreateUser(user *User) error {
-	err := c.store.CreateUser(user)
+func (c *CachedUserStore) CreateUser(ctx context.Context, user *User) error {
+	err := c.store.CreateUser(ctx, user)
 	if err != nil {
 		return err
 	}
 
-	ctx := context.Background()
-	
-	// Сбрасываем кеш списка всех пользователей
-	if cacheErr := c.cache.Delete(ctx, "users:all"); cacheErr != nil {
-		log.Printf("Failed to invalidate users cache: %v", cacheErr)
+	if !c.cacheAvailable() {
+		return nil
 	}
 
-	// Кешируем нового пользователя
+	ctx = invalidationContext(ctx)
+
+	// Сбрасываем кеш всех страниц списка пользователей
+	c.invalidateNamespace(ctx, listCacheNamespace)
+
+	// Кешируем нового пользователя. Отсутствие пользователя с этим ID могло
+	// быть закешировано, в том числе в локальных кешах других экземпляров,
+	// поэтому ключ сначала удаляется
 	if user.ID > 0 {
-		cacheKey := fmt.Sprintf("user:%d", user.ID)
-		if cacheErr := c.cache.Set(ctx, cacheKey, *user, 10*time.Minute); cacheErr != nil {
+		cacheKey := userCacheKey(user.ID)
+		if cacheErr := c.cacheDelete(ctx, cacheKey); cacheErr != nil {
+			log.Printf("Failed to invalidate user %d cache: %v", user.ID, cacheErr)
+		}
+		if cacheErr := setEntry(c, ctx, cacheKey, *user, userCacheTTL, 0); cacheErr != nil {
 			log.Printf("Failed to cache new user %d: %v", user.ID, cacheErr)
 		}
 	}
@@ -102,48 +153,387 @@ func (c *CachedUserStore) CreateUser(user *User) error {
 	return nil
 }
 
-// UpdateUser обновляет пользователя и сбрасывает кеш
-func (c *CachedUserStore) UpdateUser(id int, user *User) error {
-	err := c.store.UpdateUser(id, user)
-	if err != nil {
+// errBatchUnsupported возвращается пакетными операциями, если хранилище
+// не реализует BatchUserStore.
+var errBatchUnsupported = fmt.Errorf("batch operations: %w", errors.ErrUnsupported)
+
+// GetUsersByIDs возвращает пользователей пакетом из хранилища. Кеш не
+// используется: пакет и так читается за один обмен с сервером.
+func (c *CachedUserStore) GetUsersByIDs(ctx context.Context, ids []int) ([]User, error) {
+	batch, ok := c.store.(BatchUserStore)
+	if !ok {
+		return nil, errBatchUnsupported
+	}
+	return batch.GetUsersByIDs(ctx, ids)
+}
+
+// BulkCreateUsers создает пользователей пакетом и сбрасывает кеш их ID
+// (в нем могло быть закешировано отсутствие) и всех страниц списка.
+func (c *CachedUserStore) BulkCreateUsers(ctx context.Context, users []*User) error {
+	batch, ok := c.store.(BatchUserStore)
+	if !ok {
+		return errBatchUnsupported
+	}
+	if err := batch.BulkCreateUsers(ctx, users); err != nil {
 		return err
 	}
 
-	ctx := context.Background()
-	
-	// Сбрасываем кеш конкретного пользователя
-	cacheKey := fmt.Sprintf("user:%d", id)
-	if cacheErr := c.cache.Delete(ctx, cacheKey); cacheErr != nil {
-		log.Printf("Failed to invalidate user %d cache: %v", id, cacheErr)
+	ids := make([]int, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.ID)
 	}
+	c.invalidateUser(ctx, ids...)
+	return nil
+}
 
-	// Сбрасываем кеш списка всех пользователей
-	if cacheErr := c.cache.Delete(ctx, "users:all"); cacheErr != nil {
-		log.Printf("Failed to invalidate users cache: %v", cacheErr)
+// UpdateUser обновляет пользователя и сбрасывает кеш
+func (c *CachedUserStore) UpdateUser(ctx context.Context, id int, user *User) error {
+	err := c.store.UpdateUser(ctx, id, user)
+	if err != nil {
+		return err
 	}
 
+	c.invalidateUser(ctx, id)
 	return nil
 }
 
+// PatchUser частично обновляет пользователя и сбрасывает кеш
+func (c *CachedUserStore) PatchUser(ctx context.Context, id int, patch UserPatch) (*User, error) {
+	user, err := c.store.PatchUser(ctx, id, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	c.invalidateUser(ctx, id)
+	return user, nil
+}
+
 // DeleteUser удаляет пользователя и сбрасывает кеш
-func (c *CachedUserStore) DeleteUser(id int) error {
-	err := c.store.DeleteUser(id)
+func (c *CachedUserStore) DeleteUser(ctx context.Context, id int, version int) error {
+	err := c.store.DeleteUser(ctx, id, version)
 	if err != nil {
 		return err
 	}
 
-	ctx := context.Background()
-	
-	// Сбрасываем кеш конкретного пользователя
-	cacheKey := fmt.Sprintf("user:%d", id)
-	if cacheErr := c.cache.Delete(ctx, cacheKey); cacheErr != nil {
-		log.Printf("Failed to invalidate user %d cache: %v", id, cacheErr)
+	c.invalidateUser(ctx, id)
+	return nil
+}
+
+// RestoreUser восстанавливает пользователя и сбрасывает кеш
+func (c *CachedUserStore) RestoreUser(ctx context.Context, id int) (*User, error) {
+	user, err := c.store.RestoreUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.invalidateUser(ctx, id)
+	return user, nil
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей и сбрасывает кеш
+func (c *CachedUserStore) PurgeDeletedUsers(ctx context.Context, retention time.Duration) ([]int, error) {
+	ids, err := c.store.PurgeDeletedUsers(ctx, retention)
+	if err != nil {
+		return nil, err
+	}
+
+	// Страницы списка с include_deleted могли содержать удаленных пользователей
+	if len(ids) > 0 {
+		c.invalidateUser(ctx, ids...)
 	}
+	return ids, nil
+}
+
+// GetUserHistory возвращает историю изменений пользователя без кеширования
+func (c *CachedUserStore) GetUserHistory(ctx context.Context, id int, opts HistoryOptions) (*EventPage, error) {
+	return c.store.GetUserHistory(ctx, id, opts)
+}
+
+// InvalidateUsers сбрасывает кеш указанных пользователей и всех страниц списка.
+// Используется, когда изменения произошли в обход CachedUserStore.
+func (c *CachedUserStore) InvalidateUsers(ctx context.Context, ids ...int) {
+	c.invalidateUser(ctx, ids...)
+}
+
+// InvalidateAll сбрасывает кеш всех пользователей и всех страниц списка.
+func (c *CachedUserStore) InvalidateAll(ctx context.Context) {
+	if !c.cacheAvailable() {
+		return
+	}
+	c.invalidateNamespace(ctx, userCacheNamespace)
+	c.invalidateNamespace(ctx, listCacheNamespace)
+}
 
-	// Сбрасываем кеш списка всех пользователей
-	if cacheErr := c.cache.Delete(ctx, "users:all"); cacheErr != nil {
-		log.Printf("Failed to invalidate users cache: %v", cacheErr)
+// invalidateNamespace сбрасывает все ключи пространства имен: одной
+// операцией, если кеш это поддерживает, иначе удалением по шаблону.
+func (c *CachedUserStore) invalidateNamespace(ctx context.Context, namespace string) {
+	ns := c.stats.namespace(namespace)
+	defer ns.observe(time.Now())
+
+	var err error
+	if invalidator, ok := c.cache.(NamespaceInvalidator); ok {
+		err = invalidator.InvalidateNamespace(ctx, namespace)
+	} else {
+		err = c.cache.DeletePattern(ctx, namespace+":*")
+	}
+	if err != nil {
+		ns.errors.Add(1)
+		log.Printf("Failed to invalidate %s cache: %v", namespace, err)
+		return
 	}
+	ns.invalidations.Add(1)
+}
 
+// Stats возвращает статистику обращений к кешу по пространствам имен ключей.
+func (c *CachedUserStore) Stats() map[string]CacheNamespaceStats {
+	return c.stats.snapshot()
+}
+
+// cacheGet читает ключ из кеша и учитывает ошибки чтения.
+func (c *CachedUserStore) cacheGet(ctx context.Context, key string, dest interface{}) error {
+	ns := c.stats.namespace(keyNamespace(key))
+	defer ns.observe(time.Now())
+
+	err := c.cache.Get(ctx, key, dest)
+	if err != nil && !errors.Is(err, ErrCacheMiss) {
+		ns.errors.Add(1)
+	}
+	return err
+}
+
+// recordRead учитывает попадание или промах в статистике и в CacheRecorder
+// запроса. writtenAt — время записи значения при попадании.
+func (c *CachedUserStore) recordRead(ctx context.Context, key string, hit bool, writtenAt time.Time) {
+	ns := c.stats.namespace(keyNamespace(key))
+	if hit {
+		ns.hits.Add(1)
+	} else {
+		ns.misses.Add(1)
+	}
+	recordCacheResult(ctx, hit, writtenAt)
+}
+
+// cacheSet записывает ключ в кеш и учитывает запись.
+func (c *CachedUserStore) cacheSet(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	ns := c.stats.namespace(keyNamespace(key))
+	defer ns.observe(time.Now())
+
+	if err := c.cache.Set(ctx, key, value, ttl); err != nil {
+		ns.errors.Add(1)
+		return err
+	}
+	ns.sets.Add(1)
+	return nil
+}
+
+// cacheDelete удаляет ключ из кеша и учитывает удаление.
+func (c *CachedUserStore) cacheDelete(ctx context.Context, key string) error {
+	ns := c.stats.namespace(keyNamespace(key))
+	defer ns.observe(time.Now())
+
+	if err := c.cache.Delete(ctx, key); err != nil {
+		ns.errors.Add(1)
+		return err
+	}
+	ns.invalidations.Add(1)
 	return nil
-} 
\ No newline at end of file
+}
+
+// invalidationContext возвращает контекст для обновления кеша после записи.
+// Запись в БД уже выполнена, поэтому сброс кеша не должен прерываться вместе
+// с отменой запроса клиента.
+func invalidationContext(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
+}
+
+// invalidateUser сбрасывает кеш пользователей и всех страниц списка.
+func (c *CachedUserStore) invalidateUser(ctx context.Context, ids ...int) {
+	ctx = invalidationContext(ctx)
+	c.evictUsers(ctx, ids...)
+
+	if c.ReplicaLagGrace > 0 {
+		time.AfterFunc(c.ReplicaLagGrace, func() {
+			c.evictUsers(ctx, ids...)
+		})
+	}
+}
+
+// evictUsers удаляет из кеша пользователей и все страницы списка.
+// Недоступный кеш пропускается: после восстановления его целиком сбрасывает
+// InvalidateAll.
+func (c *CachedUserStore) evictUsers(ctx context.Context, ids ...int) {
+	if !c.cacheAvailable() {
+		return
+	}
+
+	// Сбрасываем кеш конкретных пользователей
+	for _, id := range ids {
+		if cacheErr := c.cacheDelete(ctx, userCacheKey(id)); cacheErr != nil {
+			log.Printf("Failed to invalidate user %d cache: %v", id, cacheErr)
+		}
+	}
+
+	// Сбрасываем кеш всех страниц списка пользователей
+	c.invalidateNamespace(ctx, listCacheNamespace)
+}
+
+// cacheSchemaVersion — версия формата записей кеша. Увеличивается при
+// изменении cacheEntry, User или UserPage: записи другой версии считаются
+// промахом, и в ответ не попадают значения со старым набором полей.
+const cacheSchemaVersion = 2
+
+// cacheEntry — конверт значения в кеше.
+type cacheEntry[T any] struct {
+	// Schema — версия формата записи (cacheSchemaVersion).
+	Schema int `json:"schema"`
+	// WrittenAt — когда значение было загружено из хранилища.
+	WrittenAt time.Time `json:"written_at"`
+	// Source — экземпляр приложения, записавший значение.
+	Source string `json:"source,omitempty"`
+	Value  T      `json:"value"`
+	// NotFound — текст ошибки, если запись — tombstone: хранилище не нашло
+	// значение, и этот результат закеширован на NegativeTTL.
+	NotFound string `json:"not_found,omitempty"`
+	// Delta — время загрузки значения из хранилища.
+	Delta time.Duration `json:"delta"`
+	// ExpiresAt — когда истекает ключ в кеше.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// fetch возвращает значение ключа из кеша, а при промахе загружает его через
+// load и кеширует на ttl. Одновременные промахи одного ключа в процессе
+// выполняют одну загрузку. Незадолго до истечения ключ с вероятностью,
+// растущей по мере приближения срока, перезагружается в фоне (XFetch), так что
+// горячий ключ обновляет один запрос, а не все экземпляры сразу после истечения.
+func fetch[T any](c *CachedUserStore, ctx context.Context, key string, ttl time.Duration, load func(ctx context.Context) (*T, error)) (*T, error) {
+	// Запрос, привязанный к основному серверу, не читает кеш: ключ мог
+	// заполнить параллельный запрос, прочитавший реплику до записи.
+	// Загруженное значение сохраняется в кеш как обычно
+	if usePrimary(ctx) {
+		recordCacheResult(ctx, false, time.Time{})
+		log.Printf("Bypassing cache for %s, reading from primary", key)
+		return loadShared(c, ctx, key, ttl, load)
+	}
+
+	var entry cacheEntry[T]
+	err := c.cacheGet(ctx, key, &entry)
+	if err == nil && entry.Schema != cacheSchemaVersion {
+		log.Printf("Ignoring cache entry %s with schema %d, expected %d", key, entry.Schema, cacheSchemaVersion)
+		err = ErrCacheMiss
+	}
+	c.recordRead(ctx, key, err == nil, entry.WrittenAt)
+
+	if err == nil {
+		age := time.Since(entry.WrittenAt).Round(time.Millisecond)
+		if entry.NotFound != "" {
+			log.Printf("Returning cached not found for %s (age %v, source %s)", key, age, entry.Source)
+			return nil, cachedNotFound(entry.NotFound)
+		}
+		if c.shouldRefresh(entry.Delta, entry.ExpiresAt) {
+			log.Printf("Refreshing cache key %s ahead of expiry", key)
+			c.loads.Go(ctx, flightKey(ctx, key), c.LoadTimeout, func(ctx context.Context) (interface{}, error) {
+				return loadEntry(c, ctx, key, ttl, load)
+			})
+		}
+		log.Printf("Returning %s from cache (age %v, source %s)", key, age, entry.Source)
+		return &entry.Value, nil
+	}
+
+	log.Printf("Cache miss, fetching %s from database", key)
+	return loadShared(c, ctx, key, ttl, load)
+}
+
+// loadShared загружает значение через loadEntry, объединяя одновременные
+// загрузки одного ключа. Загрузку могут ждать несколько запросов, поэтому
+// отмена одного из них ее не прерывает; каждый запрос перестает ждать при
+// своей отмене, а загрузка отменяется, когда не осталось ни одного
+// ожидающего, или по истечении LoadTimeout.
+func loadShared[T any](c *CachedUserStore, ctx context.Context, key string, ttl time.Duration, load func(ctx context.Context) (*T, error)) (*T, error) {
+	val, err := c.loads.Do(ctx, flightKey(ctx, key), c.LoadTimeout, func(ctx context.Context) (interface{}, error) {
+		return loadEntry(c, ctx, key, ttl, load)
+	})
+	if err != nil {
+		return nil, err
+	}
+	value := *val.(*T)
+	return &value, nil
+}
+
+// loadEntry загружает значение из хранилища и сохраняет его в кеш.
+func loadEntry[T any](c *CachedUserStore, ctx context.Context, key string, ttl time.Duration, load func(ctx context.Context) (*T, error)) (*T, error) {
+	started := time.Now()
+	value, err := load(ctx)
+	if errors.Is(err, ErrNotFound) && c.NegativeTTL > 0 {
+		// Кешируем отсутствие, чтобы повторные запросы несуществующих ID
+		// не доходили до хранилища
+		tombstone := newEntry(c, *new(T), 0, c.NegativeTTL)
+		tombstone.NotFound = err.Error()
+		if cacheErr := c.cacheSet(ctx, key, tombstone, c.NegativeTTL); cacheErr != nil {
+			log.Printf("Failed to cache not found for %s: %v", key, cacheErr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheErr := setEntry(c, ctx, key, *value, ttl, time.Since(started)); cacheErr != nil {
+		log.Printf("Failed to cache %s: %v", key, cacheErr)
+	}
+	return value, nil
+}
+
+// newEntry создает конверт значения, которое истечет через ttl.
+func newEntry[T any](c *CachedUserStore, value T, delta, ttl time.Duration) cacheEntry[T] {
+	now := time.Now()
+	return cacheEntry[T]{
+		Schema:    cacheSchemaVersion,
+		WrittenAt: now,
+		Source:    c.Source,
+		Value:     value,
+		Delta:     delta,
+		ExpiresAt: now.Add(ttl),
+	}
+}
+
+// setEntry сохраняет значение в кеш на ttl со случайным сдвигом TTLJitter.
+func setEntry[T any](c *CachedUserStore, ctx context.Context, key string, value T, ttl, delta time.Duration) error {
+	ttl = c.jitter(ttl)
+	return c.cacheSet(ctx, key, newEntry(c, value, delta, ttl), ttl)
+}
+
+// cachedNotFound — ошибка отсутствия записи, прочитанная из tombstone.
+// Сохраняет текст исходной ошибки и, как она, соответствует ErrNotFound.
+type cachedNotFound string
+
+func (e cachedNotFound) Error() string { return string(e) }
+
+func (e cachedNotFound) Unwrap() error { return ErrNotFound }
+
+// jitter случайно сдвигает ttl на долю TTLJitter в обе стороны.
+func (c *CachedUserStore) jitter(ttl time.Duration) time.Duration {
+	if c.TTLJitter <= 0 {
+		return ttl
+	}
+	spread := float64(ttl) * c.TTLJitter
+	return ttl + time.Duration(spread*(2*rand.Float64()-1))
+}
+
+// shouldRefresh решает, обновить ли ключ раньше срока: вероятность растет
+// по мере приближения expiresAt и тем выше, чем дольше загружалось значение.
+func (c *CachedUserStore) shouldRefresh(delta time.Duration, expiresAt time.Time) bool {
+	if c.EarlyRefreshBeta <= 0 || delta <= 0 {
+		return false
+	}
+	// 1-rand.Float64() лежит в (0, 1], поэтому логарифм конечен
+	early := time.Duration(float64(delta) * c.EarlyRefreshBeta * -math.Log(1-rand.Float64()))
+	return !time.Now().Add(early).Before(expiresAt)
+}
+
+// flightKey возвращает ключ объединения загрузок. Запросы, привязанные к
+// основному серверу, не ждут загрузку с реплики.
+func flightKey(ctx context.Context, key string) string {
+	if usePrimary(ctx) {
+		return key + "@primary"
+	}
+	return key
+}
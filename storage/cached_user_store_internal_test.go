@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// refreshCount возвращает, сколько из n вызовов shouldRefresh решили обновить
+// ключ, до истечения которого осталось remaining.
+func refreshCount(c *CachedUserStore, delta, remaining time.Duration, n int) int {
+	count := 0
+	for i := 0; i < n; i++ {
+		if c.shouldRefresh(delta, time.Now().Add(remaining)) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestShouldRefresh(t *testing.T) {
+	const trials = 2000
+	c := &CachedUserStore{EarlyRefreshBeta: 1}
+	delta := 100 * time.Millisecond
+
+	if n := refreshCount(c, delta, userCacheTTL, trials); n != 0 {
+		t.Errorf("right after a write: %d of %d calls refresh, want none", n, trials)
+	}
+	if n := refreshCount(c, delta, 0, trials); n != trials {
+		t.Errorf("at expiry: %d of %d calls refresh, want all", n, trials)
+	}
+	if n := refreshCount(c, delta, -time.Second, trials); n != trials {
+		t.Errorf("after expiry: %d of %d calls refresh, want all", n, trials)
+	}
+
+	// Вероятность растет по мере приближения срока: exp(-remaining/delta)
+	far := refreshCount(c, delta, 3*delta, trials)
+	near := refreshCount(c, delta, delta/10, trials)
+	if far == 0 || far >= near || near == trials {
+		t.Errorf("refreshes with 300ms left = %d, with 10ms left = %d of %d; want 0 < far < near < all",
+			far, near, trials)
+	}
+
+	// Значения, загруженные мгновенно, и нулевой коэффициент не обновляются
+	if n := refreshCount(c, 0, 0, trials); n != 0 {
+		t.Errorf("zero load time: %d of %d calls refresh, want none", n, trials)
+	}
+	off := &CachedUserStore{}
+	if n := refreshCount(off, delta, 0, trials); n != 0 {
+		t.Errorf("EarlyRefreshBeta = 0: %d of %d calls refresh, want none", n, trials)
+	}
+}
+
+func TestJitterStaysWithinBounds(t *testing.T) {
+	c := &CachedUserStore{TTLJitter: 0.1}
+	ttl := 10 * time.Minute
+	lo, hi := 9*time.Minute, 11*time.Minute
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 1000; i++ {
+		got := c.jitter(ttl)
+		if got < lo || got > hi {
+			t.Fatalf("jitter(%v) = %v, want within [%v, %v]", ttl, got, lo, hi)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("jitter(%v) always returned %v, want spread TTLs", ttl, ttl)
+	}
+
+	c.TTLJitter = 0
+	if got := c.jitter(ttl); got != ttl {
+		t.Errorf("jitter(%v) with TTLJitter = 0 = %v, want unchanged", ttl, got)
+	}
+}
@@ -0,0 +1,393 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/avetis74/12_app_factors/storage/storagetest"
+)
+
+// countingStore считает обращения к хранилищу за пользователями.
+type countingStore struct {
+	storage.UserStore
+	gets atomic.Int64
+}
+
+func (s *countingStore) GetUser(ctx context.Context, id int) (*storage.User, error) {
+	s.gets.Add(1)
+	return s.UserStore.GetUser(ctx, id)
+}
+
+func TestCachedUserStore(t *testing.T) {
+	storagetest.TestUserStore(t, func(t *testing.T) storage.UserStore {
+		return storage.NewCachedUserStore(storage.NewMemoryStore(), storage.NewMemoryCache())
+	})
+}
+
+func TestCachedUserStorePrimaryBypassesCache(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	cached := storage.NewCachedUserStore(store, storage.NewMemoryCache())
+
+	user := &storage.User{Name: "Ann", Email: "ann@example.com", Status: "active"}
+	if err := cached.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	// Запись в обход CachedUserStore оставляет в кеше прежнее значение, как
+	// если бы ключ заполнил запрос, прочитавший отстающую реплику
+	changed := &storage.User{Name: "Annie", Email: user.Email, Status: user.Status}
+	if err := store.UpdateUser(ctx, user.ID, changed); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := cached.GetUser(ctx, user.ID); err != nil || got.Name != "Ann" {
+		t.Fatalf("GetUser() = %+v, %v; want cached Ann", got, err)
+	}
+
+	got, err := cached.GetUser(storage.WithPrimary(ctx), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Annie" {
+		t.Errorf("GetUser(WithPrimary) = %q, want Annie", got.Name)
+	}
+
+	// Значение, прочитанное с основного сервера, заменяет устаревшее
+	if got, err := cached.GetUser(ctx, user.ID); err != nil || got.Name != "Annie" {
+		t.Errorf("GetUser() after primary read = %+v, %v; want Annie", got, err)
+	}
+}
+
+func TestCachedUserStoreBypassesDegradedCache(t *testing.T) {
+	ctx := context.Background()
+	cache := storagetest.DegradedCache(t)
+
+	store := &countingStore{UserStore: storage.NewMemoryStore()}
+	cached := storage.NewCachedUserStore(store, cache)
+	user := &storage.User{Name: "Ann", Email: "ann@example.com", Status: "active"}
+	if err := cached.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser with degraded cache: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		got, err := cached.GetUser(ctx, user.ID)
+		if err != nil || got.Name != "Ann" {
+			t.Fatalf("GetUser() = %+v, %v; want Ann from the store", got, err)
+		}
+	}
+	if n := store.gets.Load(); n != 3 {
+		t.Errorf("store GetUser calls = %d, want 3: every read goes to the store", n)
+	}
+
+	// Кеш не вызывался вовсе, поэтому ошибок Redis в статистике нет
+	for namespace, stats := range cached.Stats() {
+		if stats.Errors != 0 || stats.Hits != 0 {
+			t.Errorf("Stats()[%s] = %+v, want no cache calls while degraded", namespace, stats)
+		}
+	}
+	if status := cache.Status(); status.State != storage.CacheStateDegraded || status.LastError == "" {
+		t.Errorf("Status() = %+v, want degraded with the last error", status)
+	}
+}
+
+// newCountingCachedStore создает CachedUserStore поверх MemoryStore
+// со счетчиком обращений и MemoryCache.
+func newCountingCachedStore() (*storage.CachedUserStore, *countingStore, *storage.MemoryCache) {
+	store := &countingStore{UserStore: storage.NewMemoryStore()}
+	cache := storage.NewMemoryCache()
+	return storage.NewCachedUserStore(store, cache), store, cache
+}
+
+func TestCachedUserStoreCachesNotFound(t *testing.T) {
+	ctx := context.Background()
+	cached, store, _ := newCountingCachedStore()
+
+	for i := 0; i < 3; i++ {
+		if _, err := cached.GetUser(ctx, 999); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("GetUser(999) #%d: err = %v, want ErrNotFound", i, err)
+		}
+	}
+	if n := store.gets.Load(); n != 1 {
+		t.Errorf("store GetUser calls = %d, want 1: repeated lookups use the tombstone", n)
+	}
+}
+
+func TestCachedUserStoreTombstoneExpires(t *testing.T) {
+	ctx := context.Background()
+	cached, store, _ := newCountingCachedStore()
+	cached.NegativeTTL = 50 * time.Millisecond
+
+	if _, err := cached.GetUser(ctx, 999); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetUser(999): err = %v, want ErrNotFound", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := cached.GetUser(ctx, 999); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetUser(999) after NegativeTTL: err = %v, want ErrNotFound", err)
+	}
+	if n := store.gets.Load(); n != 2 {
+		t.Errorf("store GetUser calls = %d, want 2: the tombstone expires after NegativeTTL", n)
+	}
+}
+
+func TestCachedUserStoreCreateClearsTombstone(t *testing.T) {
+	ctx := context.Background()
+	cached, _, _ := newCountingCachedStore()
+
+	// MemoryStore выдает ID по порядку, начиная с 1
+	if _, err := cached.GetUser(ctx, 1); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetUser(1) before create: err = %v, want ErrNotFound", err)
+	}
+	user := &storage.User{Name: "Ann", Email: "ann@example.com", Status: "active"}
+	if err := cached.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 1 {
+		t.Fatalf("CreateUser assigned ID %d, want 1", user.ID)
+	}
+
+	got, err := cached.GetUser(ctx, 1)
+	if err != nil || got.Name != "Ann" {
+		t.Errorf("GetUser(1) after create = %+v, %v; want Ann", got, err)
+	}
+}
+
+func TestCachedUserStoreBulkCreateClearsTombstones(t *testing.T) {
+	ctx := context.Background()
+	cached := storage.NewCachedUserStore(storagetest.BatchStore{UserStore: storage.NewMemoryStore()}, storage.NewMemoryCache())
+
+	// MemoryStore выдает ID по порядку, начиная с 1
+	for _, id := range []int{1, 2} {
+		if _, err := cached.GetUser(ctx, id); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("GetUser(%d) before import: err = %v, want ErrNotFound", id, err)
+		}
+	}
+	users := []*storage.User{
+		{Name: "Ann", Email: "ann@example.com", Status: "active"},
+		{Name: "Bob", Email: "bob@example.com", Status: "active"},
+	}
+	if err := cached.BulkCreateUsers(ctx, users); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := cached.GetUsersByIDs(ctx, []int{2, 1})
+	if err != nil || len(got) != 2 || got[0].Name != "Bob" || got[1].Name != "Ann" {
+		t.Fatalf("GetUsersByIDs(2, 1) = %+v, %v; want Bob and Ann", got, err)
+	}
+	for _, u := range users {
+		if got, err := cached.GetUser(ctx, u.ID); err != nil || got.Name != u.Name {
+			t.Errorf("GetUser(%d) after import = %+v, %v; want %s", u.ID, got, err, u.Name)
+		}
+	}
+}
+
+func TestCachedUserStoreBatchUnsupported(t *testing.T) {
+	ctx := context.Background()
+	cached := storage.NewCachedUserStore(storage.NewMemoryStore(), storage.NewMemoryCache())
+
+	if _, err := cached.GetUsersByIDs(ctx, []int{1}); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("GetUsersByIDs: err = %v, want ErrUnsupported", err)
+	}
+	users := []*storage.User{{Name: "Ann", Email: "ann@example.com", Status: "active"}}
+	if err := cached.BulkCreateUsers(ctx, users); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("BulkCreateUsers: err = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestCachedUserStoreCacheMissIsNotCachedNotFound(t *testing.T) {
+	ctx := context.Background()
+	cached, _, cache := newCountingCachedStore()
+
+	var entry map[string]interface{}
+	if err := cache.Get(ctx, "user:999", &entry); !errors.Is(err, storage.ErrCacheMiss) {
+		t.Fatalf("Get of an absent key: err = %v, want ErrCacheMiss", err)
+	}
+
+	_, err := cached.GetUser(ctx, 999)
+	if !errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrCacheMiss) {
+		t.Fatalf("GetUser(999): err = %v, want ErrNotFound and not ErrCacheMiss", err)
+	}
+
+	// Теперь ключ есть в кеше: это tombstone, а не промах
+	if err := cache.Get(ctx, "user:999", &entry); err != nil {
+		t.Fatalf("Get of the tombstone: %v", err)
+	}
+	if entry["not_found"] == "" || entry["not_found"] == nil {
+		t.Errorf("cached entry = %v, want a not_found tombstone", entry)
+	}
+	if _, err := cached.GetUser(ctx, 999); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetUser(999) from the tombstone: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCachedUserStoreIgnoresOtherSchemaVersions(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry interface{}
+	}{
+		// Пользователь, закешированный до конверта и до поля Status
+		{"pre-envelope user", map[string]interface{}{"id": 1, "name": "Stale", "email": "ann@example.com"}},
+		{"missing schema", map[string]interface{}{"value": map[string]interface{}{"id": 1, "name": "Stale"}}},
+		{"old schema", map[string]interface{}{"schema": 1, "value": map[string]interface{}{"id": 1, "name": "Stale"}}},
+		{"newer schema", map[string]interface{}{"schema": 1000, "value": map[string]interface{}{"id": 1, "name": "Stale"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cached, store, cache := newCountingCachedStore()
+			user := &storage.User{Name: "Ann", Email: "ann@example.com", Status: "active"}
+			if err := store.CreateUser(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+			if err := cache.Set(ctx, "user:1", tt.entry, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, recorder := storage.WithCacheRecorder(ctx)
+			got, err := cached.GetUser(ctx, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != "Ann" || got.Status != "active" {
+				t.Errorf("GetUser() = %+v, want Ann reloaded from the store", got)
+			}
+			if n := store.gets.Load(); n != 1 {
+				t.Errorf("store GetUser calls = %d, want 1", n)
+			}
+			if hit, _, ok := recorder.Result(); !ok || hit {
+				t.Errorf("recorded hit = %v, %v; want a miss", hit, ok)
+			}
+
+			// Перезагруженное значение записано в текущем формате
+			if got, err := cached.GetUser(context.Background(), user.ID); err != nil || got.Name != "Ann" {
+				t.Errorf("second GetUser() = %+v, %v; want Ann", got, err)
+			}
+			if n := store.gets.Load(); n != 1 {
+				t.Errorf("store GetUser calls after reload = %d, want 1: the entry is rewritten", n)
+			}
+		})
+	}
+}
+
+// blockingStore задерживает загрузку пользователей до закрытия release
+// и считает обращения к хранилищу.
+type blockingStore struct {
+	storage.UserStore
+	gets    atomic.Int64
+	release chan struct{}
+}
+
+func (s *blockingStore) GetUser(ctx context.Context, id int) (*storage.User, error) {
+	s.gets.Add(1)
+	<-s.release
+	return s.UserStore.GetUser(ctx, id)
+}
+
+func TestCachedUserStoreCoalescesConcurrentMisses(t *testing.T) {
+	const concurrency = 50
+	ctx := context.Background()
+	store := &blockingStore{UserStore: storage.NewMemoryStore(), release: make(chan struct{})}
+	user := &storage.User{Name: "Ann", Email: "ann@example.com", Status: "active"}
+	if err := store.UserStore.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	cached := storage.NewCachedUserStore(store, storage.NewMemoryCache())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := cached.GetUser(ctx, user.ID)
+			if err == nil && got.Name != "Ann" {
+				err = fmt.Errorf("GetUser() = %+v, want Ann", got)
+			}
+			errs <- err
+		}()
+	}
+
+	// Все запросы успевают промахнуться и дождаться одной загрузки
+	time.Sleep(100 * time.Millisecond)
+	close(store.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if n := store.gets.Load(); n != 1 {
+		t.Errorf("store GetUser calls = %d for %d concurrent misses, want 1", n, concurrency)
+	}
+}
+
+// stuckStore не отвечает, пока не отменен контекст загрузки, и сообщает
+// в canceled об отмене.
+type stuckStore struct {
+	storage.UserStore
+	started  chan struct{}
+	canceled chan error
+}
+
+func (s *stuckStore) GetUser(ctx context.Context, id int) (*storage.User, error) {
+	close(s.started)
+	<-ctx.Done()
+	s.canceled <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func newStuckStore() *stuckStore {
+	return &stuckStore{
+		UserStore: storage.NewMemoryStore(),
+		started:   make(chan struct{}),
+		canceled:  make(chan error, 1),
+	}
+}
+
+func TestCachedUserStoreCancelsLoadWithoutWaiters(t *testing.T) {
+	store := newStuckStore()
+	cached := storage.NewCachedUserStore(store, storage.NewMemoryCache())
+	cached.LoadTimeout = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := cached.GetUser(ctx, 1)
+		errs <- err
+	}()
+
+	<-store.started
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetUser() after cancel: err = %v, want context.Canceled", err)
+	}
+	select {
+	case err := <-store.canceled:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("store saw ctx.Err() = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("store load was not canceled after its only caller left")
+	}
+}
+
+func TestCachedUserStoreLoadTimeout(t *testing.T) {
+	store := newStuckStore()
+	cached := storage.NewCachedUserStore(store, storage.NewMemoryCache())
+	cached.LoadTimeout = 50 * time.Millisecond
+
+	_, err := cached.GetUser(context.Background(), 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetUser() err = %v, want context.DeadlineExceeded", err)
+	}
+	if err := <-store.canceled; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("store saw ctx.Err() = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Значение в кеше начинается с байта заголовка 0x80 | сериализатор<<4 |
+// сжатие, поэтому его можно прочитать независимо от текущих настроек:
+// при смене кодека во время поэтапного развертывания экземпляры читают
+// значения, записанные друг другом. Значения без заголовка (первый байт
+// меньше 0x80) записаны до появления кодеков и читаются как JSON.
+const codecHeader byte = 0x80
+
+// Идентификаторы сериализаторов в заголовке.
+const (
+	serializerJSON    byte = 0
+	serializerMsgpack byte = 1
+)
+
+// Идентификаторы алгоритмов сжатия в заголовке.
+const (
+	compressionNone byte = 0
+	compressionGzip byte = 1
+	compressionZstd byte = 2
+)
+
+// DefaultCompressionThreshold — размер закодированного значения в байтах,
+// начиная с которого оно сжимается.
+const DefaultCompressionThreshold = 1024
+
+// MaxCacheValueSize — наибольший размер значения кеша после распаковки.
+// Поврежденное или подложенное сжатое значение не может занять больше памяти.
+const MaxCacheValueSize = 8 << 20
+
+// errValueTooLarge — распакованное значение больше MaxCacheValueSize.
+var errValueTooLarge = fmt.Errorf("decompressed value exceeds %d bytes", MaxCacheValueSize)
+
+// Serializer преобразует значения кеша в байты и обратно.
+type Serializer interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Compressor сжимает закодированные значения кеша.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	serializers = map[byte]Serializer{
+		serializerJSON:    jsonSerializer{},
+		serializerMsgpack: msgpackSerializer{},
+	}
+	serializerNames = map[string]byte{
+		"json":    serializerJSON,
+		"msgpack": serializerMsgpack,
+	}
+
+	compressors = map[byte]Compressor{
+		compressionGzip: gzipCompressor{},
+		compressionZstd: &zstdCompressor{},
+	}
+	compressionNames = map[string]byte{
+		"none": compressionNone,
+		"gzip": compressionGzip,
+		"zstd": compressionZstd,
+	}
+)
+
+// EncodedValue — значение, уже закодированное Codec. RedisCache сохраняет
+// его без повторного кодирования, а при чтении в *EncodedValue возвращает
+// как есть, например чтобы TieredCache хранил локально те же байты.
+type EncodedValue []byte
+
+// Codec кодирует значения кеша выбранным сериализатором и сжимает их,
+// если они больше Threshold. Читает значения, записанные любым кодеком.
+type Codec struct {
+	serializer  byte
+	compression byte
+	// Threshold — размер значения в байтах, начиная с которого оно сжимается.
+	Threshold int
+}
+
+// DefaultCodec кодирует значения в JSON без сжатия.
+var DefaultCodec = &Codec{serializer: serializerJSON, compression: compressionNone}
+
+// NewCodec создает кодек по именам сериализатора (json, msgpack) и сжатия
+// (none, gzip, zstd).
+func NewCodec(serializer, compression string, threshold int) (*Codec, error) {
+	s, ok := serializerNames[serializer]
+	if !ok {
+		return nil, fmt.Errorf("unknown cache serializer %q: must be json or msgpack", serializer)
+	}
+	c, ok := compressionNames[compression]
+	if !ok {
+		return nil, fmt.Errorf("unknown cache compression %q: must be none, gzip or zstd", compression)
+	}
+	return &Codec{serializer: s, compression: c, Threshold: threshold}, nil
+}
+
+// Encode кодирует значение и добавляет заголовок.
+func (c *Codec) Encode(v interface{}) ([]byte, error) {
+	data, err := serializers[c.serializer].Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal value: %w", err)
+	}
+
+	compression := compressionNone
+	if c.compression != compressionNone && len(data) >= c.Threshold {
+		compressed, err := compressors[c.compression].Compress(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress value: %w", err)
+		}
+		// Несжимаемые данные хранятся как есть
+		if len(compressed) < len(data) {
+			data, compression = compressed, c.compression
+		}
+	}
+
+	encoded := make([]byte, 0, len(data)+1)
+	encoded = append(encoded, codecHeader|c.serializer<<4|compression)
+	return append(encoded, data...), nil
+}
+
+// Decode декодирует значение по его заголовку.
+func (c *Codec) Decode(data []byte, v interface{}) error {
+	if len(data) == 0 || data[0] < codecHeader {
+		return json.Unmarshal(data, v)
+	}
+
+	header, data := data[0], data[1:]
+	serializer, ok := serializers[header>>4&0x07]
+	if !ok {
+		return fmt.Errorf("unknown cache serializer in header %#x", header)
+	}
+	if compression := header & 0x0F; compression != compressionNone {
+		compressor, ok := compressors[compression]
+		if !ok {
+			return fmt.Errorf("unknown cache compression in header %#x", header)
+		}
+		var err error
+		if data, err = compressor.Decompress(data); err != nil {
+			return fmt.Errorf("failed to decompress value: %w", err)
+		}
+	}
+	return serializer.Unmarshal(data, v)
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonSerializer) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// msgpackSerializer использует теги json, чтобы имена полей совпадали с JSON.
+type msgpackSerializer struct{}
+
+func (msgpackSerializer) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackSerializer) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	data, err = io.ReadAll(io.LimitReader(r, MaxCacheValueSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxCacheValueSize {
+		return nil, errValueTooLarge
+	}
+	return data, nil
+}
+
+// zstdCompressor создает кодировщик и декодировщик при первом использовании
+// и использует их совместно: EncodeAll и DecodeAll безопасны для
+// конкурентного использования. Декодировщик не распаковывает больше
+// MaxCacheValueSize байт и не выделяет окно больше этого размера.
+type zstdCompressor struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	err     error
+}
+
+func (z *zstdCompressor) init() error {
+	z.once.Do(func() {
+		if z.encoder, z.err = zstd.NewWriter(nil); z.err != nil {
+			return
+		}
+		z.decoder, z.err = zstd.NewReader(nil,
+			zstd.WithDecoderMaxMemory(MaxCacheValueSize),
+			zstd.WithDecoderMaxWindow(MaxCacheValueSize))
+	})
+	return z.err
+}
+
+func (z *zstdCompressor) Compress(data []byte) ([]byte, error) {
+	if err := z.init(); err != nil {
+		return nil, err
+	}
+	return z.encoder.EncodeAll(data, nil), nil
+}
+
+func (z *zstdCompressor) Decompress(data []byte) ([]byte, error) {
+	if err := z.init(); err != nil {
+		return nil, err
+	}
+	return z.decoder.DecodeAll(data, nil)
+}
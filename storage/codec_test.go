@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// codecValue — составное значение для проверки сериализаторов.
+type codecValue struct {
+	Name  string            `json:"name"`
+	Count int               `json:"count"`
+	Tags  []string          `json:"tags"`
+	Attrs map[string]string `json:"attrs"`
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	small := codecValue{Name: "Ann", Count: 1, Tags: []string{"a"}, Attrs: map[string]string{"k": "v"}}
+	large := codecValue{Name: strings.Repeat("Ann ", 1000), Count: 2, Tags: []string{"a", "b"}}
+
+	tests := []struct {
+		serializer, compression, size string
+		value                         codecValue
+		// header — ожидаемый байт заголовка.
+		header byte
+	}{
+		{"json", "none", "small", small, 0x80},
+		{"json", "none", "large", large, 0x80},
+		{"json", "gzip", "small", small, 0x80},
+		{"json", "gzip", "large", large, 0x81},
+		{"json", "zstd", "small", small, 0x80},
+		{"json", "zstd", "large", large, 0x82},
+		{"msgpack", "none", "small", small, 0x90},
+		{"msgpack", "none", "large", large, 0x90},
+		{"msgpack", "gzip", "small", small, 0x90},
+		{"msgpack", "gzip", "large", large, 0x91},
+		{"msgpack", "zstd", "small", small, 0x90},
+		{"msgpack", "zstd", "large", large, 0x92},
+	}
+	for _, tt := range tests {
+		t.Run(tt.serializer+"/"+tt.compression+"/"+tt.size, func(t *testing.T) {
+			codec, err := NewCodec(tt.serializer, tt.compression, DefaultCompressionThreshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := codec.Encode(tt.value)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if data[0] != tt.header {
+				t.Errorf("header = %#x, want %#x", data[0], tt.header)
+			}
+
+			// Заголовок позволяет прочитать значение любым кодеком
+			for _, decoder := range []*Codec{codec, DefaultCodec} {
+				var got codecValue
+				if err := decoder.Decode(data, &got); err != nil {
+					t.Fatalf("Decode: %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.value) {
+					t.Errorf("Decode() = %+v, want %+v", got, tt.value)
+				}
+			}
+		})
+	}
+}
+
+func TestCodecStoresIncompressibleData(t *testing.T) {
+	value := make([]byte, 4*DefaultCompressionThreshold)
+	rand.Read(value)
+
+	for _, compression := range []string{"gzip", "zstd"} {
+		t.Run(compression, func(t *testing.T) {
+			codec, err := NewCodec("msgpack", compression, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := codec.Encode(value)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if data[0] != 0x90 {
+				t.Errorf("header = %#x, want %#x (uncompressed)", data[0], 0x90)
+			}
+
+			var got []byte
+			if err := codec.Decode(data, &got); err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if !bytes.Equal(got, value) {
+				t.Error("Decode() returned different bytes")
+			}
+		})
+	}
+}
+
+func TestCodecDecodesLegacyJSON(t *testing.T) {
+	codec, err := NewCodec("msgpack", "zstd", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got codecValue
+	if err := codec.Decode([]byte(`{"name":"Ann","count":3,"tags":["a"]}`), &got); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	want := codecValue{Name: "Ann", Count: 3, Tags: []string{"a"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode() = %+v, want %+v", got, want)
+	}
+
+	var n int
+	if err := codec.Decode([]byte("42"), &n); err != nil || n != 42 {
+		t.Errorf("Decode(42) = %d, %v", n, err)
+	}
+}
+
+func TestCodecDecodeRejectsMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"invalid legacy json", []byte("{")},
+		{"unknown serializer", []byte{0x80 | 7<<4, '1'}},
+		{"unknown compression", []byte{0x80 | 0x0F, '1'}},
+		{"corrupt gzip", []byte{0x81, 'n', 'o', 't'}},
+		{"corrupt zstd", []byte{0x92, 'n', 'o', 't'}},
+		{"truncated msgpack", []byte{0x90, 0x85}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v interface{}
+			if err := DefaultCodec.Decode(tt.data, &v); err == nil {
+				t.Errorf("Decode(%x) = %v, want error", tt.data, v)
+			}
+		})
+	}
+}
+
+func TestNewCodecRejectsUnknownNames(t *testing.T) {
+	tests := []struct {
+		serializer, compression string
+	}{
+		{"xml", "none"},
+		{"", "none"},
+		{"json", "lz4"},
+		{"json", ""},
+	}
+	for _, tt := range tests {
+		if _, err := NewCodec(tt.serializer, tt.compression, 0); err == nil {
+			t.Errorf("NewCodec(%q, %q) = nil error", tt.serializer, tt.compression)
+		}
+	}
+}
+
+// compressedZeros возвращает значение из n нулевых байт, сжатое compression,
+// с заголовком кодека JSON.
+func compressedZeros(t *testing.T, compression string, n int) []byte {
+	t.Helper()
+	zeros := make([]byte, n)
+	switch compression {
+	case "gzip":
+		var buf bytes.Buffer
+		buf.WriteByte(0x81)
+		w := gzip.NewWriter(&buf)
+		w.Write(zeros)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	case "zstd":
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer enc.Close()
+		return enc.EncodeAll(zeros, []byte{0x82})
+	}
+	t.Fatalf("unknown compression %q", compression)
+	return nil
+}
+
+func TestCodecDecodeLimitsDecompressedSize(t *testing.T) {
+	for _, compression := range []string{"gzip", "zstd"} {
+		t.Run(compression, func(t *testing.T) {
+			// Значение на границе распаковывается, но не является JSON
+			var v interface{}
+			err := DefaultCodec.Decode(compressedZeros(t, compression, MaxCacheValueSize), &v)
+			if err == nil || strings.Contains(err.Error(), "decompress") {
+				t.Errorf("Decode(%d bytes) = %v, want a JSON error after decompression", MaxCacheValueSize, err)
+			}
+
+			data := compressedZeros(t, compression, MaxCacheValueSize+1)
+			err = DefaultCodec.Decode(data, &v)
+			if err == nil || !strings.Contains(err.Error(), "decompress") {
+				t.Errorf("Decode(%d bytes compressed to %d) = %v, want a decompression error",
+					MaxCacheValueSize+1, len(data), err)
+			}
+		})
+	}
+}
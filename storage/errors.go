@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+// Ошибки хранилища. Реализации UserStore оборачивают в них свои ошибки,
+// чтобы вызывающий код мог различать их через errors.Is независимо от СУБД.
+var (
+	// ErrNotFound — запрошенная запись не существует.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict — запись конфликтует с существующей (например, дубликат email).
+	ErrConflict = errors.New("conflict")
+	// ErrValidation — данные отклонены ограничениями хранилища.
+	ErrValidation = errors.New("validation failed")
+	// ErrPreconditionFailed — версия записи не совпала с ожидаемой.
+	ErrPreconditionFailed = errors.New("version mismatch")
+	// ErrUnavailable — хранилище временно недоступно.
+	ErrUnavailable = errors.New("storage unavailable")
+	// ErrCanceled — запрос к хранилищу отменен вызывающей стороной.
+	ErrCanceled = errors.New("request canceled")
+	// ErrTimeout — хранилище не ответило до истечения срока запроса.
+	ErrTimeout = errors.New("storage timeout")
+)
+
+// errUserNotFound возвращает ошибку отсутствия пользователя с указанным ID.
+func errUserNotFound(id int) error {
+	return fmt.Errorf("user with id %d %w", id, ErrNotFound)
+}
+
+// errVersionMismatch возвращает ошибку несовпадения версии пользователя.
+func errVersionMismatch(id int) error {
+	return fmt.Errorf("user with id %d: %w", id, ErrPreconditionFailed)
+}
+
+// translateError переводит ошибки драйверов PostgreSQL (lib/pq и pgx)
+// и SQLite в ошибки хранилища. Исходная ошибка сохраняется в цепочке и доступна
+// через errors.As.
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// Драйверы оборачивают ошибку контекста в свои, поэтому она проверяется
+	// первой: отмена запроса не означает недоступность хранилища
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("%w: %w", ErrCanceled, err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+
+	if class, ok := sqliteErrorClass(err); ok {
+		if class != nil {
+			return fmt.Errorf("%w: %w", class, err)
+		}
+		return err
+	}
+
+	if code, ok := sqlState(err); ok {
+		switch {
+		case code == "23505": // unique_violation
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		case code == "23502", // not_null_violation
+			code == "23514", // check_violation
+			code == "23503", // foreign_key_violation
+			code == "22001", // string_data_right_truncation
+			code == "22P02": // invalid_text_representation
+			return fmt.Errorf("%w: %w", ErrValidation, err)
+		case strings.HasPrefix(code, "08"), // connection_exception
+			strings.HasPrefix(code, "53"), // insufficient_resources
+			code == "57P01",               // admin_shutdown
+			code == "57P02",               // crash_shutdown
+			code == "57P03",               // cannot_connect_now
+			code == "40001",               // serialization_failure
+			code == "40P01":               // deadlock_detected
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		return err
+	}
+
+	var (
+		netErr     net.Error
+		connectErr *pgconn.ConnectError
+	)
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.As(err, &connectErr) ||
+		errors.As(err, &netErr) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	return err
+}
+
+// sqlState возвращает код SQLSTATE из ошибки сервера PostgreSQL.
+func sqlState(err error) (string, bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code), true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code, true
+	}
+	return "", false
+}
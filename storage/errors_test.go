@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+// sqliteError возвращает ошибку, которую SQLite вернул на statement после
+// создания таблицы с ограничениями.
+func sqliteError(t *testing.T, statement string) error {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE t (
+		id INTEGER PRIMARY KEY,
+		email TEXT NOT NULL UNIQUE,
+		age INTEGER CHECK (age >= 0)
+	);
+	INSERT INTO t (id, email) VALUES (1, 'ann@example.com')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(statement)
+	if err == nil {
+		t.Fatalf("%s: no error", statement)
+	}
+	return err
+}
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"nil", nil, nil},
+		{"pq unique", &pq.Error{Code: "23505"}, ErrConflict},
+		{"pq not null", &pq.Error{Code: "23502"}, ErrValidation},
+		{"pq connection", &pq.Error{Code: "08006"}, ErrUnavailable},
+		{"pgx unique", &pgconn.PgError{Code: "23505"}, ErrConflict},
+		{"pgx foreign key", &pgconn.PgError{Code: "23503"}, ErrValidation},
+		{"pgx serialization failure", &pgconn.PgError{Code: "40001"}, ErrUnavailable},
+		{"pgx deadlock", &pgconn.PgError{Code: "40P01"}, ErrUnavailable},
+		{"wrapped pgx unique", fmt.Errorf("inserting user: %w", &pgconn.PgError{Code: "23505"}), ErrConflict},
+		{"sqlite unique", sqliteError(t, `INSERT INTO t (id, email) VALUES (2, 'ann@example.com')`), ErrConflict},
+		{"sqlite primary key", sqliteError(t, `INSERT INTO t (id, email) VALUES (1, 'bob@example.com')`), ErrConflict},
+		{"sqlite not null", sqliteError(t, `INSERT INTO t (id) VALUES (2)`), ErrValidation},
+		{"sqlite check", sqliteError(t, `INSERT INTO t (id, email, age) VALUES (2, 'bob@example.com', -1)`), ErrValidation},
+		{"sql no rows", sql.ErrNoRows, ErrNotFound},
+		{"pgx no rows", pgx.ErrNoRows, ErrNotFound},
+		{"bad connection", sql.ErrConnDone, ErrUnavailable},
+		{"canceled", context.Canceled, ErrCanceled},
+		{"wrapped canceled", fmt.Errorf("query: %w", context.Canceled), ErrCanceled},
+		{"deadline", context.DeadlineExceeded, ErrTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := translateError(tt.err)
+			if tt.want == nil {
+				if got != nil {
+					t.Fatalf("translateError(nil) = %v, want nil", got)
+				}
+				return
+			}
+			if !errors.Is(got, tt.want) {
+				t.Errorf("translateError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("translateError(%v) = %v, lost the original error", tt.err, got)
+			}
+		})
+	}
+}
+
+func TestTranslateErrorKeepsUnknownErrors(t *testing.T) {
+	for _, err := range []error{
+		errors.New("boom"),
+		&pq.Error{Code: "42P01"},
+		&pgconn.PgError{Code: "42601"},
+		sqliteError(t, `SELEC 1`),
+	} {
+		if got := translateError(err); got != err {
+			t.Errorf("translateError(%v) = %v, want the error unchanged", err, got)
+		}
+	}
+}
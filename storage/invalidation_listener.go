@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// UsersChangedChannel — канал NOTIFY, в который триггер на таблице users
+// отправляет ID измененного пользователя ("*" — изменились все).
+const UsersChangedChannel = "users_changed"
+
+// UserCacheInvalidator сбрасывает закешированные данные пользователей.
+type UserCacheInvalidator interface {
+	InvalidateUsers(ctx context.Context, ids ...int)
+	InvalidateAll(ctx context.Context)
+}
+
+// CacheInvalidationListener слушает уведомления PostgreSQL об изменениях
+// таблицы users и сбрасывает соответствующие ключи кеша. Так кеш сходится
+// с БД независимо от того, где произошло изменение: в этом или другом
+// экземпляре сервиса, в миграции или в ручном запросе через psql.
+type CacheInvalidationListener struct {
+	connStr     string
+	invalidator UserCacheInvalidator
+	// BatchWindow — время накопления уведомлений перед сбросом кеша,
+	// чтобы массовые изменения не вызывали сброс списков на каждую строку.
+	BatchWindow time.Duration
+	// MinBackoff и MaxBackoff ограничивают задержку между попытками
+	// подписаться на уведомления и переподключения к БД.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// PingInterval — период проверки соединения с БД.
+	PingInterval time.Duration
+}
+
+// NewCacheInvalidationListener создает слушателя для указанной БД.
+func NewCacheInvalidationListener(connStr string, invalidator UserCacheInvalidator) *CacheInvalidationListener {
+	return &CacheInvalidationListener{
+		connStr:      connStr,
+		invalidator:  invalidator,
+		BatchWindow:  50 * time.Millisecond,
+		MinBackoff:   time.Second,
+		MaxBackoff:   time.Minute,
+		PingInterval: 90 * time.Second,
+	}
+}
+
+// Run слушает уведомления, пока не будет отменен контекст. Если подписаться
+// не удалось, попытки повторяются с экспоненциальной задержкой.
+func (l *CacheInvalidationListener) Run(ctx context.Context) {
+	backoff := l.MinBackoff
+	for attempt := 0; ; attempt++ {
+		err := l.listen(ctx, attempt > 0)
+		if ctx.Err() != nil {
+			log.Println("Cache invalidation listener stopped")
+			return
+		}
+		log.Printf("Failed to listen for %s notifications, retrying in %s: %v", UsersChangedChannel, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			log.Println("Cache invalidation listener stopped")
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, l.MaxBackoff)
+	}
+}
+
+// listen подписывается на уведомления и обрабатывает их, пока не будет
+// отменен контекст. Ошибка возвращается, если подписаться не удалось.
+// resync означает, что предыдущая попытка не удалась: уведомления за это
+// время потеряны, поэтому после подписки весь кеш сбрасывается. То же
+// происходит, если БД была недоступна, пока подписка ждала подключения.
+func (l *CacheInvalidationListener) listen(ctx context.Context, resync bool) error {
+	var connectFailed atomic.Bool
+	listener := pq.NewListener(l.connStr, l.MinBackoff, l.MaxBackoff, func(ev pq.ListenerEventType, err error) {
+		if ev == pq.ListenerEventConnectionAttemptFailed {
+			connectFailed.Store(true)
+		}
+		if err != nil {
+			log.Printf("Cache invalidation listener error: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	// Listen ждет подключения к БД и не принимает контекст; Close при
+	// отмене контекста прерывает ожидание
+	listened := make(chan error, 1)
+	go func() { listened <- listener.Listen(UsersChangedChannel) }()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-listened:
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Listening for %s notifications", UsersChangedChannel)
+	if resync || connectFailed.Load() {
+		log.Println("Invalidating all cached users")
+		l.invalidator.InvalidateAll(ctx)
+	}
+
+	return l.dispatch(ctx, listener.Notify, listener.Ping)
+}
+
+// dispatch сбрасывает кеш по уведомлениям из notify, пока не будет отменен
+// контекст. Каждые PingInterval соединение проверяется через ping:
+// pq.Listener не обнаруживает разрыв без трафика. Таймер общий для всего
+// цикла, поэтому проверка выполняется и при постоянном потоке уведомлений.
+func (l *CacheInvalidationListener) dispatch(ctx context.Context, notify <-chan *pq.Notification, ping func() error) error {
+	keepalive := time.NewTicker(l.PingInterval)
+	defer keepalive.Stop()
+
+	pending := map[int]struct{}{}
+	all := false
+	var flush <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case n := <-notify:
+			// nil приходит после переподключения: уведомления за время
+			// разрыва потеряны, поэтому сбрасываем весь кеш
+			if n == nil || n.Extra == "*" {
+				all = true
+			} else if id, err := strconv.Atoi(n.Extra); err == nil {
+				pending[id] = struct{}{}
+			} else {
+				log.Printf("Ignoring malformed %s payload: %q", UsersChangedChannel, n.Extra)
+				continue
+			}
+			if flush == nil {
+				flush = time.After(l.BatchWindow)
+			}
+
+		case <-flush:
+			flush = nil
+			if all {
+				log.Println("Invalidating all cached users")
+				l.invalidator.InvalidateAll(ctx)
+			} else {
+				ids := make([]int, 0, len(pending))
+				for id := range pending {
+					ids = append(ids, id)
+				}
+				log.Printf("Invalidating cache for %d changed users", len(ids))
+				l.invalidator.InvalidateUsers(ctx, ids...)
+			}
+			pending = map[int]struct{}{}
+			all = false
+
+		case <-keepalive.C:
+			// Ping ждет ответа БД, поэтому не задерживает обработку уведомлений;
+			// при разрыве pq.Listener переподключается сам
+			go ping()
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// invalidation — один вызов UserCacheInvalidator; all — InvalidateAll.
+type invalidation struct {
+	ids []int
+	all bool
+}
+
+// recordingInvalidator передает вызовы сброса кеша в канал.
+type recordingInvalidator chan invalidation
+
+func (r recordingInvalidator) InvalidateUsers(ctx context.Context, ids ...int) {
+	slices.Sort(ids)
+	r <- invalidation{ids: ids}
+}
+
+func (r recordingInvalidator) InvalidateAll(ctx context.Context) {
+	r <- invalidation{all: true}
+}
+
+// startDispatch запускает dispatch с фальшивым каналом уведомлений
+// и возвращает канал для уведомлений и полученные сбросы.
+func startDispatch(t *testing.T, pingInterval time.Duration, ping func() error) (chan<- *pq.Notification, recordingInvalidator) {
+	t.Helper()
+	invalidations := make(recordingInvalidator, 10)
+	l := NewCacheInvalidationListener("", invalidations)
+	l.BatchWindow = 50 * time.Millisecond
+	l.PingInterval = pingInterval
+
+	ctx, cancel := context.WithCancel(context.Background())
+	notify := make(chan *pq.Notification)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.dispatch(ctx, notify, ping)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return notify, invalidations
+}
+
+// expectInvalidation ждет следующий сброс кеша и сравнивает его с want.
+func expectInvalidation(t *testing.T, invalidations recordingInvalidator, want invalidation) {
+	t.Helper()
+	select {
+	case got := <-invalidations:
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("invalidation = %+v, want %+v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no invalidation, want %+v", want)
+	}
+}
+
+func TestCacheInvalidationListenerDispatch(t *testing.T) {
+	notify, invalidations := startDispatch(t, time.Hour, func() error { return nil })
+
+	// Уведомления за BatchWindow объединяются, некорректные пропускаются
+	for _, payload := range []string{"7", "5", "bogus", "7", ""} {
+		notify <- &pq.Notification{Channel: UsersChangedChannel, Extra: payload}
+	}
+	expectInvalidation(t, invalidations, invalidation{ids: []int{5, 7}})
+
+	notify <- &pq.Notification{Channel: UsersChangedChannel, Extra: "3"}
+	notify <- &pq.Notification{Channel: UsersChangedChannel, Extra: "*"}
+	expectInvalidation(t, invalidations, invalidation{all: true})
+
+	// nil — переподключение, уведомления могли потеряться
+	notify <- nil
+	expectInvalidation(t, invalidations, invalidation{all: true})
+
+	notify <- &pq.Notification{Channel: UsersChangedChannel, Extra: "42"}
+	expectInvalidation(t, invalidations, invalidation{ids: []int{42}})
+}
+
+func TestCacheInvalidationListenerPingsUnderSteadyTraffic(t *testing.T) {
+	var pings atomic.Int64
+	notify, invalidations := startDispatch(t, 30*time.Millisecond, func() error {
+		pings.Add(1)
+		return nil
+	})
+
+	// Уведомления приходят чаще PingInterval, но проверка соединения
+	// все равно выполняется
+	deadline := time.Now().Add(300 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		notify <- &pq.Notification{Channel: UsersChangedChannel, Extra: "1"}
+		time.Sleep(5 * time.Millisecond)
+		select {
+		case <-invalidations:
+		default:
+		}
+	}
+	if pings.Load() == 0 {
+		t.Error("connection was never pinged under steady notification traffic")
+	}
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// loadGroup объединяет одновременные загрузки одного ключа, как
+// singleflight.Group, но считает ожидающих: когда все они отменены,
+// загрузка отменяется. Нулевое значение готово к использованию.
+type loadGroup struct {
+	mu    sync.Mutex
+	calls map[string]*loadCall
+}
+
+// loadCall — выполняющаяся загрузка ключа.
+type loadCall struct {
+	done    chan struct{}
+	val     interface{}
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Do выполняет fn для key или присоединяется к уже выполняющейся загрузке и
+// ждет ее результат. fn получает контекст, не связанный с отменой ctx, но
+// ограниченный timeout (0 — без ограничения); он отменяется, когда загрузку
+// перестает ждать последний запрос.
+func (g *loadGroup) Do(ctx context.Context, key string, timeout time.Duration, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	call := g.start(ctx, key, timeout, fn)
+	call.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+			g.forget(key, call)
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// Go запускает fn для key в фоне, если загрузка ключа еще не выполняется,
+// и не ждет ее. Загрузку ограничивает только timeout, пока к ней не
+// присоединится Do.
+func (g *loadGroup) Go(ctx context.Context, key string, timeout time.Duration, fn func(ctx context.Context) (interface{}, error)) {
+	g.mu.Lock()
+	g.start(ctx, key, timeout, fn)
+	g.mu.Unlock()
+}
+
+// start возвращает выполняющуюся загрузку key или запускает новую.
+// Вызывается под g.mu.
+func (g *loadGroup) start(ctx context.Context, key string, timeout time.Duration, fn func(ctx context.Context) (interface{}, error)) *loadCall {
+	if call, ok := g.calls[key]; ok {
+		return call
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*loadCall)
+	}
+
+	var (
+		loadCtx context.Context
+		cancel  context.CancelFunc
+	)
+	if timeout > 0 {
+		loadCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	} else {
+		loadCtx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+	}
+	call := &loadCall{done: make(chan struct{}), cancel: cancel}
+	g.calls[key] = call
+
+	go func() {
+		defer cancel()
+		call.val, call.err = fn(loadCtx)
+		g.mu.Lock()
+		g.forget(key, call)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	return call
+}
+
+// forget убирает загрузку из группы, если ее еще не сменила новая.
+// Вызывается под g.mu.
+func (g *loadGroup) forget(key string, call *loadCall) {
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+}
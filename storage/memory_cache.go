@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval — как часто MemoryCache удаляет истекшие ключи,
+// к которым больше не обращались.
+const memorySweepInterval = time.Minute
+
+// memoryEntry — значение в MemoryCache.
+type memoryEntry struct {
+	data []byte
+	// expiresAt — время истечения; нулевое значение означает бессрочный ключ.
+	expiresAt time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// MemoryCache реализует CacheService в памяти процесса. Повторяет поведение
+// RedisCache: значения хранятся в JSON, истекают по TTL (0 — без истечения),
+// DeletePattern понимает glob-шаблоны Redis. Безопасен для конкурентного
+// использования.
+type MemoryCache struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+}
+
+// NewMemoryCache создает пустой кеш в памяти.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		entries:   make(map[string]memoryEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Set сохраняет значение в кеше
+func (m *MemoryCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	entry := memoryEntry{data: data}
+	if expiration > 0 {
+		entry.expiresAt = now.Add(expiration)
+	}
+	m.entries[key] = entry
+
+	if now.Sub(m.lastSweep) >= memorySweepInterval {
+		m.sweep(now)
+	}
+	return nil
+}
+
+// Get получает значение из кеша
+func (m *MemoryCache) Get(ctx context.Context, key string, dest interface{}) error {
+	m.mu.Lock()
+	entry, ok := m.entries[key]
+	if ok && entry.expired(time.Now()) {
+		delete(m.entries, key)
+		ok = false
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return ErrCacheMiss
+	}
+	if err := json.Unmarshal(entry.data, dest); err != nil {
+		return fmt.Errorf("failed to unmarshal cached data: %w", err)
+	}
+	return nil
+}
+
+// Delete удаляет ключ из кеша
+func (m *MemoryCache) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+// DeletePattern удаляет все ключи по glob-шаблону Redis
+func (m *MemoryCache) DeletePattern(ctx context.Context, pattern string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.entries {
+		if matchPattern(pattern, key) {
+			delete(m.entries, key)
+		}
+	}
+	return nil
+}
+
+// Close ничего не делает и нужен для единообразия с RedisCache.
+func (m *MemoryCache) Close() error {
+	return nil
+}
+
+// sweep удаляет истекшие ключи. Вызывается под блокировкой.
+func (m *MemoryCache) sweep(now time.Time) {
+	for key, entry := range m.entries {
+		if entry.expired(now) {
+			delete(m.entries, key)
+		}
+	}
+	m.lastSweep = now
+}
+
+// matchPattern сопоставляет ключ с glob-шаблоном по правилам команды Redis
+// KEYS: '*' — любая последовательность, '?' — один символ, '[...]' — класс
+// символов (с отрицанием '^' и диапазонами 'a-z'), '\' экранирует символ.
+func matchPattern(pattern, key string) bool {
+	p, k := []rune(pattern), []rune(key)
+	for len(p) > 0 {
+		switch p[0] {
+		case '*':
+			for len(p) > 1 && p[1] == '*' {
+				p = p[1:]
+			}
+			if len(p) == 1 {
+				return true
+			}
+			for i := 0; i <= len(k); i++ {
+				if matchPattern(string(p[1:]), string(k[i:])) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(k) == 0 {
+				return false
+			}
+			p, k = p[1:], k[1:]
+		case '[':
+			if len(k) == 0 {
+				return false
+			}
+			end, matched := matchClass(p, k[0])
+			if !matched {
+				return false
+			}
+			p, k = p[end:], k[1:]
+		default:
+			if p[0] == '\\' && len(p) > 1 {
+				p = p[1:]
+			}
+			if len(k) == 0 || p[0] != k[0] {
+				return false
+			}
+			p, k = p[1:], k[1:]
+		}
+	}
+	return len(k) == 0
+}
+
+// matchClass сопоставляет символ с классом '[...]' в начале шаблона
+// и возвращает длину класса в шаблоне.
+func matchClass(p []rune, c rune) (int, bool) {
+	i := 1
+	negate := i < len(p) && p[i] == '^'
+	if negate {
+		i++
+	}
+	matched := false
+	for ; i < len(p) && p[i] != ']'; i++ {
+		switch {
+		case p[i] == '\\' && i+1 < len(p):
+			i++
+			matched = matched || p[i] == c
+		case i+2 < len(p) && p[i+1] == '-' && p[i+2] != ']':
+			lo, hi := p[i], p[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			matched = matched || (c >= lo && c <= hi)
+			i += 2
+		default:
+			matched = matched || p[i] == c
+		}
+	}
+	// Незакрытый класс Redis считает закрытым в конце шаблона
+	if i < len(p) {
+		i++
+	}
+	return i, matched != negate
+}
@@ -0,0 +1,16 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/avetis74/12_app_factors/storage/storagetest"
+)
+
+func TestMemoryCache(t *testing.T) {
+	storagetest.TestCacheService(t, func(t *testing.T) storage.CacheService {
+		c := storage.NewMemoryCache()
+		t.Cleanup(func() { c.Close() })
+		return c
+	})
+}
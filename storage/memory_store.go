@@ -0,0 +1,371 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MemoryURL — адрес, по которому вместо PostgreSQL или Redis используются
+// хранилища в памяти процесса (для тестов и разработки без внешних сервисов).
+const MemoryURL = "memory://"
+
+// IsMemoryURL сообщает, что адрес выбирает хранилище в памяти.
+func IsMemoryURL(url string) bool {
+	return strings.HasPrefix(url, MemoryURL)
+}
+
+// Ограничения длины колонок таблицы users (VARCHAR).
+const (
+	maxNameLength   = 255
+	maxEmailLength  = 255
+	maxStatusLength = 20
+)
+
+// MemoryStore реализует интерфейс UserStore в памяти процесса.
+// Повторяет поведение PostgresStore: мягкое удаление, уникальность email
+// среди неудаленных пользователей, версии и историю изменений. Данные не
+// сохраняются между запусками, события outbox не формируются.
+// Безопасен для конкурентного использования.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	users       map[int]*User
+	events      []UserEvent
+	nextUserID  int
+	nextEventID int
+}
+
+// NewMemoryStore создает пустое хранилище пользователей в памяти.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:       make(map[int]*User),
+		nextUserID:  1,
+		nextEventID: 1,
+	}
+}
+
+// ListUsers возвращает страницу пользователей с учетом фильтров и сортировки.
+func (s *MemoryStore) ListUsers(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	opts = opts.Normalize()
+
+	var lastID int
+	if opts.Cursor != "" {
+		id, err := decodeCursor(opts.Cursor, opts.Sort)
+		if err != nil {
+			return nil, err
+		}
+		lastID = id
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []User
+	for _, u := range s.users {
+		switch {
+		case u.DeletedAt != nil && !opts.IncludeDeleted,
+			opts.Status != "" && u.Status != opts.Status,
+			opts.EmailPrefix != "" && !strings.HasPrefix(strings.ToLower(u.Email), strings.ToLower(opts.EmailPrefix)),
+			opts.NamePrefix != "" && !strings.HasPrefix(strings.ToLower(u.Name), strings.ToLower(opts.NamePrefix)),
+			lastID != 0 && opts.Sort == SortByIDDesc && u.ID >= lastID,
+			lastID != 0 && opts.Sort != SortByIDDesc && u.ID <= lastID:
+			continue
+		}
+		users = append(users, *u)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if opts.Sort == SortByIDDesc {
+			return users[i].ID > users[j].ID
+		}
+		return users[i].ID < users[j].ID
+	})
+	if len(users) > opts.Limit+1 {
+		users = users[:opts.Limit+1]
+	}
+	if users == nil {
+		users = []User{}
+	}
+	return newUserPage(users, opts), nil
+}
+
+// GetUser находит одного пользователя по ID.
+func (s *MemoryStore) GetUser(ctx context.Context, id int) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok || u.DeletedAt != nil {
+		return nil, errUserNotFound(id)
+	}
+	cp := *u
+	return &cp, nil
+}
+
+// CreateUser создает нового пользователя.
+func (s *MemoryStore) CreateUser(ctx context.Context, user *User) error {
+	if user.Status == "" {
+		user.Status = StatusActive
+	}
+	if err := validateColumns(user.Name, user.Email, user.Status); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkEmail(user.Email, 0); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	created := &User{
+		ID:        s.nextUserID,
+		Name:      user.Name,
+		Email:     user.Email,
+		Status:    user.Status,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Version:   1,
+	}
+	s.nextUserID++
+	s.users[created.ID] = created
+	*user = *created
+
+	s.recordEvent(ctx, created.ID, OpCreate, nil, created)
+	log.Printf("User created with ID: %d", user.ID)
+	return nil
+}
+
+// UpdateUser обновляет данные пользователя по ID.
+func (s *MemoryStore) UpdateUser(ctx context.Context, id int, user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.activeUser(id, user.Version)
+	if err != nil {
+		return err
+	}
+
+	status := user.Status
+	if status == "" {
+		status = current.Status
+	}
+	if err := validateColumns(user.Name, user.Email, status); err != nil {
+		return err
+	}
+	if err := s.checkEmail(user.Email, id); err != nil {
+		return err
+	}
+
+	before := *current
+	current.Name, current.Email, current.Status = user.Name, user.Email, status
+	s.touch(current)
+	*user = *current
+
+	s.recordEvent(ctx, id, OpUpdate, &before, current)
+	return nil
+}
+
+// PatchUser обновляет только переданные в патче поля пользователя
+// и возвращает его актуальное состояние.
+func (s *MemoryStore) PatchUser(ctx context.Context, id int, patch UserPatch) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.activeUser(id, patch.Version)
+	if err != nil {
+		return nil, err
+	}
+	if patch.IsEmpty() {
+		cp := *current
+		return &cp, nil
+	}
+
+	next := *current
+	if patch.Name != nil {
+		next.Name = *patch.Name
+	}
+	if patch.Email != nil {
+		next.Email = *patch.Email
+	}
+	if patch.Status != nil {
+		next.Status = *patch.Status
+	}
+	if err := validateColumns(next.Name, next.Email, next.Status); err != nil {
+		return nil, err
+	}
+	if err := s.checkEmail(next.Email, id); err != nil {
+		return nil, err
+	}
+
+	before := *current
+	current.Name, current.Email, current.Status = next.Name, next.Email, next.Status
+	s.touch(current)
+
+	s.recordEvent(ctx, id, OpUpdate, &before, current)
+	cp := *current
+	return &cp, nil
+}
+
+// DeleteUser мягко удаляет пользователя по ID.
+func (s *MemoryStore) DeleteUser(ctx context.Context, id int, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.activeUser(id, version)
+	if err != nil {
+		return err
+	}
+
+	before := *current
+	s.touch(current)
+	deletedAt := current.UpdatedAt
+	current.DeletedAt = &deletedAt
+
+	s.recordEvent(ctx, id, OpDelete, &before, current)
+	return nil
+}
+
+// RestoreUser восстанавливает мягко удаленного пользователя.
+func (s *MemoryStore) RestoreUser(ctx context.Context, id int) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.users[id]
+	if !ok || current.DeletedAt == nil {
+		return nil, lockedUserNotFound(id, true)
+	}
+	// Email мог быть занят другим пользователем после удаления
+	if err := s.checkEmail(current.Email, id); err != nil {
+		return nil, err
+	}
+
+	before := *current
+	current.DeletedAt = nil
+	s.touch(current)
+
+	s.recordEvent(ctx, id, OpRestore, &before, current)
+	cp := *current
+	return &cp, nil
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, мягко удаленных
+// раньше, чем retention назад.
+func (s *MemoryStore) PurgeDeletedUsers(ctx context.Context, retention time.Duration) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().UTC().Add(-retention)
+	var ids []int
+	for id, u := range s.users {
+		if u.DeletedAt != nil && u.DeletedAt.Before(cutoff) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		purged := *s.users[id]
+		delete(s.users, id)
+		s.recordEvent(ctx, id, OpPurge, &purged, nil)
+	}
+	return ids, nil
+}
+
+// GetUserHistory возвращает историю изменений пользователя от новых событий
+// к старым. История доступна и для удаленных пользователей.
+func (s *MemoryStore) GetUserHistory(ctx context.Context, id int, opts HistoryOptions) (*EventPage, error) {
+	opts = opts.Normalize()
+
+	var lastID int
+	if opts.Cursor != "" {
+		eventID, err := decodeCursor(opts.Cursor, SortByIDDesc)
+		if err != nil {
+			return nil, err
+		}
+		lastID = eventID
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := make([]UserEvent, 0, opts.Limit+1)
+	for i := len(s.events) - 1; i >= 0 && len(events) <= opts.Limit; i-- {
+		e := s.events[i]
+		if e.UserID != id || (lastID != 0 && e.ID >= lastID) {
+			continue
+		}
+		events = append(events, e)
+	}
+
+	if len(events) == 0 && opts.Cursor == "" {
+		if _, ok := s.users[id]; !ok {
+			return nil, errUserNotFound(id)
+		}
+	}
+	return newEventPage(events, opts), nil
+}
+
+// activeUser возвращает неудаленного пользователя и проверяет его версию.
+// Вызывается под блокировкой.
+func (s *MemoryStore) activeUser(id int, version int) (*User, error) {
+	u, ok := s.users[id]
+	if !ok || u.DeletedAt != nil {
+		return nil, errUserNotFound(id)
+	}
+	if err := checkVersion(u, version); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// checkEmail проверяет, что email не занят другим неудаленным пользователем,
+// как уникальный индекс users_email_active_key. Вызывается под блокировкой.
+func (s *MemoryStore) checkEmail(email string, exceptID int) error {
+	for _, u := range s.users {
+		if u.ID != exceptID && u.DeletedAt == nil && u.Email == email {
+			return fmt.Errorf("%w: email %s is already taken", ErrConflict, email)
+		}
+	}
+	return nil
+}
+
+// touch отмечает изменение пользователя. Вызывается под блокировкой.
+func (s *MemoryStore) touch(u *User) {
+	u.UpdatedAt = time.Now().UTC()
+	u.Version++
+}
+
+// recordEvent добавляет событие в историю. Вызывается под блокировкой.
+func (s *MemoryStore) recordEvent(ctx context.Context, userID int, op string, before, after *User) {
+	diffBefore, diffAfter := userDiff(before, after)
+	s.events = append(s.events, UserEvent{
+		ID:        s.nextEventID,
+		UserID:    userID,
+		Actor:     ActorFromContext(ctx),
+		Operation: op,
+		Before:    diffBefore,
+		After:     diffAfter,
+		CreatedAt: time.Now().UTC(),
+	})
+	s.nextEventID++
+}
+
+// validateColumns повторяет ограничения колонок таблицы users.
+func validateColumns(name, email, status string) error {
+	switch {
+	case utf8.RuneCountInString(name) > maxNameLength:
+		return fmt.Errorf("%w: name is longer than %d characters", ErrValidation, maxNameLength)
+	case utf8.RuneCountInString(email) > maxEmailLength:
+		return fmt.Errorf("%w: email is longer than %d characters", ErrValidation, maxEmailLength)
+	case utf8.RuneCountInString(status) > maxStatusLength:
+		return fmt.Errorf("%w: status is longer than %d characters", ErrValidation, maxStatusLength)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/avetis74/12_app_factors/storage/storagetest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storagetest.TestUserStore(t, func(t *testing.T) storage.UserStore {
+		return storage.NewMemoryStore()
+	})
+}
@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+)
+
+// Типы событий, публикуемых через outbox.
+const (
+	EventUserCreated = "user.created"
+	EventUserUpdated = "user.updated"
+	EventUserDeleted = "user.deleted"
+)
+
+// DefaultEventStream — поток Redis, в который публикуются события пользователей.
+const DefaultEventStream = "users.events"
+
+// outboxPruneBatch — сколько опубликованных событий удаляется за один запрос,
+// чтобы очистка не держала блокировки на большом числе строк.
+const outboxPruneBatch = 1000
+
+// outboxLockID — ключ advisory-блокировки, которая гарантирует, что события
+// одновременно публикует только один ретранслятор, и сохраняет их порядок.
+const outboxLockID = 7_202_501
+
+// OutboxMessage описывает событие, ожидающее публикации.
+type OutboxMessage struct {
+	ID        int64           `json:"id"`
+	UserID    int             `json:"user_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// outboxPayload — тело события, которое получают подписчики.
+type outboxPayload struct {
+	User       *User     `json:"user"`
+	Operation  string    `json:"operation"`
+	Actor      string    `json:"actor"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// outboxEventType сопоставляет операцию истории с типом публикуемого события.
+func outboxEventType(op string) string {
+	switch op {
+	case OpCreate:
+		return EventUserCreated
+	case OpDelete, OpPurge:
+		return EventUserDeleted
+	default:
+		return EventUserUpdated
+	}
+}
+
+// newOutboxPayload сериализует тело события outbox для изменения пользователя.
+func newOutboxPayload(ctx context.Context, op string, before, after *User) ([]byte, error) {
+	state := after
+	if state == nil {
+		state = before
+	}
+	payload, err := json.Marshal(outboxPayload{
+		User:       state,
+		Operation:  op,
+		Actor:      ActorFromContext(ctx),
+		OccurredAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal outbox payload: %w", err)
+	}
+	return payload, nil
+}
+
+// EventPublisher публикует события из outbox во внешнюю систему.
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, msg OutboxMessage) error
+}
+
+// OutboxRelay переносит события из таблицы outbox в EventPublisher.
+// Доставка выполняется по принципу at-least-once: событие помечается
+// опубликованным только после успешной публикации, поэтому при сбое оно
+// может быть опубликовано повторно. Подписчики должны учитывать event_id.
+// Опубликованные события хранятся Retention и затем удаляются.
+type OutboxRelay struct {
+	DB           *sql.DB
+	Publisher    EventPublisher
+	BatchSize    int
+	PollInterval time.Duration
+	// Retention — срок хранения опубликованных событий; 0 отключает очистку.
+	Retention time.Duration
+	// PruneInterval — период удаления опубликованных событий старше Retention.
+	PruneInterval time.Duration
+}
+
+// NewOutboxRelay создает ретранслятор с параметрами по умолчанию.
+func NewOutboxRelay(db *sql.DB, publisher EventPublisher) *OutboxRelay {
+	return &OutboxRelay{
+		DB:            db,
+		Publisher:     publisher,
+		BatchSize:     100,
+		PollInterval:  time.Second,
+		Retention:     7 * 24 * time.Hour,
+		PruneInterval: time.Hour,
+	}
+}
+
+// Run опрашивает outbox, пока не будет отменен контекст.
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	log.Printf("Outbox relay started (batch %d, interval %v, retention %v)", r.BatchSize, r.PollInterval, r.Retention)
+	var lastPrune time.Time
+	for {
+		if r.Retention > 0 && time.Since(lastPrune) >= r.PruneInterval {
+			if _, err := r.PrunePublished(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Error pruning published outbox events: %v", err)
+			}
+			lastPrune = time.Now()
+		}
+
+		n, err := r.RelayBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error relaying outbox events: %v", err)
+		}
+
+		// Если пакет заполнен целиком, сразу забираем следующий
+		if err == nil && n == r.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Outbox relay stopped")
+			return ctx.Err()
+		case <-time.After(r.PollInterval):
+		}
+	}
+}
+
+// RelayBatch публикует один пакет неопубликованных событий по порядку
+// и возвращает количество опубликованных.
+func (r *OutboxRelay) RelayBatch(ctx context.Context) (int, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	defer tx.Rollback()
+
+	// Если блокировку держит другой экземпляр, пропускаем цикл: параллельная
+	// публикация нарушила бы порядок событий одного пользователя
+	var locked bool
+	if err := tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1)", outboxLockID).Scan(&locked); err != nil {
+		return 0, translateError(err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		"SELECT id, user_id, event_type, payload, created_at FROM outbox WHERE published_at IS NULL ORDER BY id LIMIT $1",
+		r.BatchSize)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	var messages []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		if err := rows.Scan(&m.ID, &m.UserID, &m.EventType, &m.Payload, &m.CreatedAt); err != nil {
+			rows.Close()
+			return 0, translateError(err)
+		}
+		messages = append(messages, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, translateError(err)
+	}
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	// Публикуем строго по порядку и останавливаемся на первой ошибке, чтобы
+	// более поздние события не обогнали неопубликованное
+	published := make([]int64, 0, len(messages))
+	var publishErr error
+	for _, m := range messages {
+		if publishErr = r.Publisher.PublishEvent(ctx, m); publishErr != nil {
+			break
+		}
+		published = append(published, m.ID)
+	}
+
+	if len(published) > 0 {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE outbox SET published_at = CURRENT_TIMESTAMP WHERE id = ANY($1)",
+			pq.Array(published)); err != nil {
+			return 0, translateError(err)
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, translateError(err)
+		}
+		log.Printf("Relayed %d outbox events", len(published))
+	}
+
+	if publishErr != nil {
+		return len(published), fmt.Errorf("failed to publish outbox event: %w", publishErr)
+	}
+	return len(published), nil
+}
+
+// PrunePublished удаляет события, опубликованные раньше, чем Retention назад,
+// и возвращает их количество. Неопубликованные события не удаляются.
+func (r *OutboxRelay) PrunePublished(ctx context.Context) (int64, error) {
+	var pruned int64
+	for {
+		res, err := r.DB.ExecContext(ctx,
+			`DELETE FROM outbox WHERE id IN (
+				SELECT id FROM outbox
+				WHERE published_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+				ORDER BY id LIMIT $2
+			)`,
+			r.Retention.Seconds(), outboxPruneBatch)
+		if err != nil {
+			return pruned, translateError(err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return pruned, translateError(err)
+		}
+		pruned += n
+		if n < outboxPruneBatch {
+			break
+		}
+	}
+
+	if pruned > 0 {
+		log.Printf("Pruned %d outbox events published more than %v ago", pruned, r.Retention)
+	}
+	return pruned, nil
+}
+
+// RedisStreamPublisher публикует события outbox в поток Redis (XADD).
+type RedisStreamPublisher struct {
+	Cache  *RedisCache
+	Stream string
+	// MaxLen приблизительно ограничивает длину потока; 0 — без ограничения.
+	MaxLen int64
+}
+
+// NewRedisStreamPublisher создает публикатор для потока stream.
+func NewRedisStreamPublisher(cache *RedisCache, stream string) *RedisStreamPublisher {
+	return &RedisStreamPublisher{Cache: cache, Stream: stream}
+}
+
+// PublishEvent добавляет событие в поток Redis.
+func (p *RedisStreamPublisher) PublishEvent(ctx context.Context, msg OutboxMessage) error {
+	args := &redis.XAddArgs{
+		Stream: p.Stream,
+		Values: map[string]interface{}{
+			"event_id":   strconv.FormatInt(msg.ID, 10),
+			"type":       msg.EventType,
+			"user_id":    strconv.Itoa(msg.UserID),
+			"payload":    string(msg.Payload),
+			"created_at": msg.CreatedAt.UTC().Format(time.RFC3339Nano),
+		},
+	}
+	if p.MaxLen > 0 {
+		args.MaxLen = p.MaxLen
+		args.Approx = true
+	}
+	return p.Cache.client.XAdd(ctx, args).Err()
+}
@@ -0,0 +1,230 @@
+package storage_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/avetis74/12_app_factors/storage"
+)
+
+// recordingPublisher запоминает опубликованные события. fail, если задана,
+// может отклонить событие до публикации.
+type recordingPublisher struct {
+	mu        sync.Mutex
+	published []storage.OutboxMessage
+	fail      func(msg storage.OutboxMessage) error
+}
+
+func (p *recordingPublisher) PublishEvent(ctx context.Context, msg storage.OutboxMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail != nil {
+		if err := p.fail(msg); err != nil {
+			return err
+		}
+	}
+	p.published = append(p.published, msg)
+	return nil
+}
+
+// forUser возвращает опубликованные события пользователя по порядку.
+func (p *recordingPublisher) forUser(userID int) []storage.OutboxMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var messages []storage.OutboxMessage
+	for _, m := range p.published {
+		if m.UserID == userID {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
+
+// eventTypes возвращает типы событий.
+func eventTypes(messages []storage.OutboxMessage) []string {
+	types := make([]string, len(messages))
+	for i, m := range messages {
+		types[i] = m.EventType
+	}
+	return types
+}
+
+// relayAll публикует все неопубликованные события в тестовой БД.
+func relayAll(t *testing.T, relay *storage.OutboxRelay) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		n, err := relay.RelayBatch(context.Background())
+		if err != nil {
+			t.Fatalf("RelayBatch: %v", err)
+		}
+		if n == 0 {
+			return
+		}
+	}
+	t.Fatal("RelayBatch did not drain the outbox")
+}
+
+// outboxCounts возвращает число опубликованных и неопубликованных событий пользователя.
+func outboxCounts(t *testing.T, db *sql.DB, userID int) (published, pending int) {
+	t.Helper()
+	err := db.QueryRow(
+		"SELECT count(*) FILTER (WHERE published_at IS NOT NULL), count(*) FILTER (WHERE published_at IS NULL) FROM outbox WHERE user_id = $1",
+		userID).Scan(&published, &pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return published, pending
+}
+
+// newOutboxTest открывает тестовую БД и PostgresStore и удаляет созданных
+// пользователей и их события после теста.
+func newOutboxTest(t *testing.T) (*sql.DB, *storage.PostgresStore) {
+	t.Helper()
+	db := openTestDB(t)
+	t.Cleanup(func() { cleanupBench(db) })
+	return db, storage.NewPostgresStore(db)
+}
+
+func TestOutboxRelayPublishesInOrder(t *testing.T) {
+	ctx := context.Background()
+	db, store := newOutboxTest(t)
+	pub := &recordingPublisher{}
+	relay := storage.NewOutboxRelay(db, pub)
+	// Сначала публикуем события, оставшиеся от других тестов
+	relayAll(t, relay)
+
+	user := newBenchUser()
+	if err := store.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.UpdateUser(ctx, user.ID, newBenchUser()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.DeleteUser(ctx, user.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	relay.BatchSize = 3
+	relayAll(t, relay)
+
+	messages := pub.forUser(user.ID)
+	want := []string{storage.EventUserCreated, storage.EventUserUpdated, storage.EventUserUpdated, storage.EventUserDeleted}
+	if got := eventTypes(messages); !reflect.DeepEqual(got, want) {
+		t.Fatalf("published events = %v, want %v", got, want)
+	}
+	for i := 1; i < len(messages); i++ {
+		if messages[i].ID <= messages[i-1].ID {
+			t.Errorf("event %d published after event %d, want increasing ids", messages[i].ID, messages[i-1].ID)
+		}
+	}
+
+	if published, pending := outboxCounts(t, db, user.ID); published != len(want) || pending != 0 {
+		t.Errorf("outbox rows: %d published, %d pending; want %d published", published, pending, len(want))
+	}
+}
+
+func TestOutboxRelayRedeliversAfterPublishFailure(t *testing.T) {
+	ctx := context.Background()
+	db, store := newOutboxTest(t)
+	pub := &recordingPublisher{}
+	relay := storage.NewOutboxRelay(db, pub)
+	relayAll(t, relay)
+
+	user := newBenchUser()
+	if err := store.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateUser(ctx, user.ID, newBenchUser()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteUser(ctx, user.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// XADD события обновления не удается один раз
+	errXAdd := errors.New("XADD failed")
+	failed := false
+	pub.fail = func(msg storage.OutboxMessage) error {
+		if msg.UserID == user.ID && msg.EventType == storage.EventUserUpdated && !failed {
+			failed = true
+			return errXAdd
+		}
+		return nil
+	}
+
+	n, err := relay.RelayBatch(ctx)
+	if !errors.Is(err, errXAdd) {
+		t.Fatalf("RelayBatch: err = %v, want the publish error", err)
+	}
+	if n != 1 {
+		t.Errorf("RelayBatch published %d events before the failure, want 1", n)
+	}
+	// Событие создания помечено, а неудачное и следующее за ним — нет,
+	// чтобы удаление не обогнало обновление
+	if published, pending := outboxCounts(t, db, user.ID); published != 1 || pending != 2 {
+		t.Fatalf("outbox rows after failure: %d published, %d pending; want 1 and 2", published, pending)
+	}
+
+	relayAll(t, relay)
+	want := []string{storage.EventUserCreated, storage.EventUserUpdated, storage.EventUserDeleted}
+	if got := eventTypes(pub.forUser(user.ID)); !reflect.DeepEqual(got, want) {
+		t.Errorf("published events = %v, want %v: each event once, in order", got, want)
+	}
+	if published, pending := outboxCounts(t, db, user.ID); published != 3 || pending != 0 {
+		t.Errorf("outbox rows after retry: %d published, %d pending; want 3 and 0", published, pending)
+	}
+}
+
+func TestOutboxRelayPrunesPublishedEvents(t *testing.T) {
+	ctx := context.Background()
+	db, store := newOutboxTest(t)
+	relay := storage.NewOutboxRelay(db, &recordingPublisher{})
+	relay.Retention = time.Hour
+
+	old, recent, pending := newBenchUser(), newBenchUser(), newBenchUser()
+	for _, u := range []*storage.User{old, recent} {
+		if err := store.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	relayAll(t, relay)
+	if _, err := db.Exec(
+		"UPDATE outbox SET published_at = CURRENT_TIMESTAMP - interval '2 hours' WHERE user_id = $1", old.ID,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateUser(ctx, pending); err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := relay.PrunePublished(ctx)
+	if err != nil {
+		t.Fatalf("PrunePublished: %v", err)
+	}
+	if pruned < 1 {
+		t.Errorf("PrunePublished = %d, want at least the expired event", pruned)
+	}
+
+	tests := []struct {
+		name               string
+		user               *storage.User
+		published, pending int
+	}{
+		{"published before retention", old, 0, 0},
+		{"published recently", recent, 1, 0},
+		{"not published", pending, 0, 1},
+	}
+	for _, tt := range tests {
+		if published, pending := outboxCounts(t, db, tt.user.ID); published != tt.published || pending != tt.pending {
+			t.Errorf("%s: %d published, %d pending; want %d and %d",
+				tt.name, published, pending, tt.published, tt.pending)
+		}
+	}
+}
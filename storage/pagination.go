@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// SortOrder задает порядок сортировки списка пользователей.
+type SortOrder string
+
+const (
+	// SortByIDAsc сортирует пользователей по возрастанию ID.
+	SortByIDAsc SortOrder = "id"
+	// SortByIDDesc сортирует пользователей по убыванию ID.
+	SortByIDDesc SortOrder = "-id"
+)
+
+const (
+	// DefaultPageSize — размер страницы, если клиент его не указал.
+	DefaultPageSize = 50
+	// MaxPageSize — максимальный размер страницы.
+	MaxPageSize = 200
+)
+
+// ErrInvalidCursor возвращается, если курсор поврежден или не соответствует
+// параметрам сортировки.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListOptions описывает параметры постраничной выборки пользователей.
+type ListOptions struct {
+	Cursor      string    `json:"cursor,omitempty"`
+	Limit       int       `json:"limit,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	EmailPrefix string    `json:"email_prefix,omitempty"`
+	NamePrefix  string    `json:"name_prefix,omitempty"`
+	Sort        SortOrder `json:"sort,omitempty"`
+	// IncludeDeleted включает в выборку мягко удаленных пользователей.
+	IncludeDeleted bool `json:"include_deleted,omitempty"`
+}
+
+// UserPage содержит одну страницу пользователей и курсор следующей страницы.
+type UserPage struct {
+	Users      []User `json:"users"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Normalize подставляет значения по умолчанию и ограничивает размер страницы.
+func (o ListOptions) Normalize() ListOptions {
+	if o.Limit <= 0 {
+		o.Limit = DefaultPageSize
+	}
+	if o.Limit > MaxPageSize {
+		o.Limit = MaxPageSize
+	}
+	if o.Sort == "" {
+		o.Sort = SortByIDAsc
+	}
+	return o
+}
+
+// ParseSortOrder разбирает порядок сортировки из строкового значения.
+func ParseSortOrder(s string) (SortOrder, bool) {
+	switch SortOrder(s) {
+	case "":
+		return SortByIDAsc, true
+	case SortByIDAsc, SortByIDDesc:
+		return SortOrder(s), true
+	}
+	return "", false
+}
+
+// cursor — внутреннее представление курсора (keyset по id).
+type cursor struct {
+	ID   int       `json:"id"`
+	Sort SortOrder `json:"sort"`
+}
+
+// encodeCursor кодирует позицию последней записи страницы в непрозрачную строку.
+func encodeCursor(id int, sort SortOrder) string {
+	data, _ := json.Marshal(cursor{ID: id, Sort: sort})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor разбирает курсор и проверяет, что он выдан для той же сортировки.
+func decodeCursor(s string, sort SortOrder) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return 0, ErrInvalidCursor
+	}
+	if c.ID <= 0 || c.Sort != sort {
+		return 0, ErrInvalidCursor
+	}
+	return c.ID, nil
+}
+
+// likePrefix экранирует спецсимволы LIKE и превращает строку в шаблон префикса.
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(strings.ToLower(prefix)) + "%"
+}
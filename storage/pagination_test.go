@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, sort := range []SortOrder{SortByIDAsc, SortByIDDesc} {
+		for _, id := range []int{1, 42, 1 << 30} {
+			got, err := decodeCursor(encodeCursor(id, sort), sort)
+			if err != nil {
+				t.Fatalf("decodeCursor(%d, %q): %v", id, sort, err)
+			}
+			if got != id {
+				t.Errorf("decodeCursor(%d, %q) = %d", id, sort, got)
+			}
+		}
+	}
+}
+
+func TestDecodeCursorRejectsMalformed(t *testing.T) {
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"not base64", "!!!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"id":1,"sort":"id"}`))},
+		{"not json", raw("id=1")},
+		{"wrong id type", raw(`{"id":"1","sort":"id"}`)},
+		{"zero id", raw(`{"id":0,"sort":"id"}`)},
+		{"negative id", raw(`{"id":-5,"sort":"id"}`)},
+		{"missing sort", raw(`{"id":1}`)},
+		{"other sort", encodeCursor(1, SortByIDDesc)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.cursor, SortByIDAsc); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decodeCursor(%q) error = %v, want ErrInvalidCursor", tt.cursor, err)
+			}
+		})
+	}
+}
+
+func TestListOptionsNormalize(t *testing.T) {
+	tests := []struct {
+		in        ListOptions
+		wantLimit int
+		wantSort  SortOrder
+	}{
+		{ListOptions{}, DefaultPageSize, SortByIDAsc},
+		{ListOptions{Limit: -1}, DefaultPageSize, SortByIDAsc},
+		{ListOptions{Limit: 10, Sort: SortByIDDesc}, 10, SortByIDDesc},
+		{ListOptions{Limit: MaxPageSize + 1}, MaxPageSize, SortByIDAsc},
+	}
+	for _, tt := range tests {
+		got := tt.in.Normalize()
+		if got.Limit != tt.wantLimit || got.Sort != tt.wantSort {
+			t.Errorf("%+v.Normalize() = limit %d, sort %q; want %d, %q",
+				tt.in, got.Limit, got.Sort, tt.wantLimit, tt.wantSort)
+		}
+	}
+}
+
+func TestParseSortOrder(t *testing.T) {
+	tests := []struct {
+		in   string
+		want SortOrder
+		ok   bool
+	}{
+		{"", SortByIDAsc, true},
+		{"id", SortByIDAsc, true},
+		{"-id", SortByIDDesc, true},
+		{"name", "", false},
+		{"+id", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseSortOrder(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseSortOrder(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLikePrefix(t *testing.T) {
+	tests := map[string]string{
+		"Ann":  "ann%",
+		"50%":  `50\%%`,
+		"a_b":  `a\_b%`,
+		`c:\d`: `c:\\d%`,
+		"":     "%",
+	}
+	for in, want := range tests {
+		if got := likePrefix(in); got != want {
+			t.Errorf("likePrefix(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultStatementCacheCapacity — сколько подготовленных запросов pgx хранит
+// на каждом соединении. Динамические запросы ListUsers и PatchUser дают
+// несколько десятков вариантов, остальные запросы статичны.
+const DefaultStatementCacheCapacity = 256
+
+// NewPgxPool открывает пул соединений pgx и проверяет доступность БД.
+// Запросы подготавливаются при первом выполнении на соединении
+// и затем переиспользуются без повторного разбора сервером.
+func NewPgxPool(ctx context.Context, connStr string) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database URL: %w", err)
+	}
+	config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	config.ConnConfig.StatementCacheCapacity = DefaultStatementCacheCapacity
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, translateError(err)
+	}
+	return pool, nil
+}
+
+// PgxStore реализует интерфейс UserStore для PostgreSQL поверх нативного
+// драйвера pgx. Поведение совпадает с PostgresStore: запросы общие,
+// отличается только способ их выполнения.
+type PgxStore struct {
+	Pool *pgxpool.Pool
+}
+
+// NewPgxStore создает новый экземпляр PgxStore.
+func NewPgxStore(pool *pgxpool.Pool) *PgxStore {
+	return &PgxStore{Pool: pool}
+}
+
+// ListUsers возвращает страницу пользователей с учетом фильтров и сортировки.
+func (s *PgxStore) ListUsers(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	opts = opts.Normalize()
+	log.Printf("Listing users: %+v", opts)
+
+	query, args, err := buildListQuery(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.Pool.Query(ctx, query, args...)
+	if err != nil {
+		log.Printf("Error querying users: %v", err)
+		return nil, translateError(err)
+	}
+	users, err := collectUsers(rows, opts.Limit+1)
+	if err != nil {
+		log.Printf("Error reading user rows: %v", err)
+		return nil, err
+	}
+
+	page := newUserPage(users, opts)
+	log.Printf("Successfully fetched %d users", len(page.Users))
+	return page, nil
+}
+
+// GetUser находит одного пользователя по ID.
+func (s *PgxStore) GetUser(ctx context.Context, id int) (*User, error) {
+	log.Printf("Fetching user with ID: %d", id)
+	u, err := scanUser(s.Pool.QueryRow(ctx, selectUserSQL, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("User with ID %d not found", id)
+			return nil, errUserNotFound(id)
+		}
+		log.Printf("Error fetching user %d: %v", id, err)
+		return nil, translateError(err)
+	}
+	log.Printf("Successfully fetched user: %s (%s)", u.Name, u.Email)
+	return &u, nil
+}
+
+// GetUsersByIDs находит активных пользователей по списку ID за один обмен
+// с сервером: запросы отправляются пакетом. Отсутствующие пользователи
+// пропускаются, порядок результата совпадает с порядком ids.
+func (s *PgxStore) GetUsersByIDs(ctx context.Context, ids []int) ([]User, error) {
+	batch := &pgx.Batch{}
+	for _, id := range ids {
+		batch.Queue(selectUserSQL, id)
+	}
+
+	results := s.Pool.SendBatch(ctx, batch)
+	defer results.Close()
+
+	users := make([]User, 0, len(ids))
+	for range ids {
+		u, err := scanUser(results.QueryRow())
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error fetching users by IDs: %v", err)
+			return nil, translateError(err)
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// CreateUser создает нового пользователя в БД.
+func (s *PgxStore) CreateUser(ctx context.Context, user *User) error {
+	log.Printf("Creating user: %s (%s)", user.Name, user.Email)
+
+	// Устанавливаем статус по умолчанию, если не указан
+	if user.Status == "" {
+		user.Status = StatusActive
+	}
+
+	err := s.withTx(ctx, func(tx pgx.Tx) error {
+		created, err := scanUser(tx.QueryRow(ctx, insertUserSQL, user.Name, user.Email, user.Status))
+		if err != nil {
+			return translateError(err)
+		}
+		*user = created
+		return s.recordEvents(ctx, tx, userChange{OpCreate, nil, user})
+	})
+	if err != nil {
+		log.Printf("Error creating user: %v", err)
+		return err
+	}
+	log.Printf("User created with ID: %d", user.ID)
+	return nil
+}
+
+// BulkCreateUsers создает пользователей одной транзакцией. Строки загружаются
+// через COPY во временную таблицу и переносятся в users одним INSERT, поэтому
+// стоимость почти не зависит от числа пользователей. При ошибке (например,
+// дубликате email) не создается ни один пользователь. Заполняет ID и служебные
+// поля переданных пользователей.
+func (s *PgxStore) BulkCreateUsers(ctx context.Context, users []*User) error {
+	if len(users) == 0 {
+		return nil
+	}
+	log.Printf("Bulk creating %d users", len(users))
+
+	err := s.withTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx,
+			"CREATE TEMP TABLE users_import (ord INTEGER, name VARCHAR(255), email VARCHAR(255), status VARCHAR(20)) ON COMMIT DROP",
+		); err != nil {
+			return translateError(err)
+		}
+
+		_, err := tx.CopyFrom(ctx,
+			pgx.Identifier{"users_import"},
+			[]string{"ord", "name", "email", "status"},
+			pgx.CopyFromSlice(len(users), func(i int) ([]interface{}, error) {
+				status := users[i].Status
+				if status == "" {
+					status = StatusActive
+				}
+				return []interface{}{i, users[i].Name, users[i].Email, status}, nil
+			}),
+		)
+		if err != nil {
+			return translateError(err)
+		}
+
+		rows, err := tx.Query(ctx,
+			"INSERT INTO users (name, email, status) SELECT name, email, status FROM users_import ORDER BY ord RETURNING "+userColumns)
+		if err != nil {
+			return translateError(err)
+		}
+		created, err := collectUsers(rows, len(users))
+		if err != nil {
+			return err
+		}
+		if len(created) != len(users) {
+			return fmt.Errorf("bulk insert returned %d rows for %d users", len(created), len(users))
+		}
+
+		changes := make([]userChange, len(created))
+		for i := range created {
+			*users[i] = created[i]
+			changes[i] = userChange{OpCreate, nil, users[i]}
+		}
+		return s.recordEvents(ctx, tx, changes...)
+	})
+	if err != nil {
+		log.Printf("Error bulk creating users: %v", err)
+		return err
+	}
+	log.Printf("Successfully created %d users", len(users))
+	return nil
+}
+
+// UpdateUser обновляет данные пользователя по ID.
+func (s *PgxStore) UpdateUser(ctx context.Context, id int, user *User) error {
+	log.Printf("Updating user %d: %s (%s)", id, user.Name, user.Email)
+
+	err := s.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := lockUserPgx(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(before, user.Version); err != nil {
+			return err
+		}
+
+		status := user.Status
+		if status == "" {
+			status = before.Status
+		}
+
+		updated, err := scanUser(tx.QueryRow(ctx, updateUserSQL, user.Name, user.Email, status, id))
+		if err != nil {
+			return translateError(err)
+		}
+		*user = updated
+		return s.recordEvents(ctx, tx, userChange{OpUpdate, before, user})
+	})
+	if err != nil {
+		log.Printf("Error updating user %d: %v", id, err)
+		return err
+	}
+	log.Printf("Successfully updated user %d", id)
+	return nil
+}
+
+// PatchUser обновляет только переданные в патче поля пользователя
+// и возвращает его актуальное состояние.
+func (s *PgxStore) PatchUser(ctx context.Context, id int, patch UserPatch) (*User, error) {
+	if patch.IsEmpty() {
+		u, err := s.GetUser(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return u, checkVersion(u, patch.Version)
+	}
+	log.Printf("Patching user %d", id)
+
+	query, args := buildPatchQuery(id, patch)
+
+	var patched User
+	err := s.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := lockUserPgx(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(before, patch.Version); err != nil {
+			return err
+		}
+
+		patched, err = scanUser(tx.QueryRow(ctx, query, args...))
+		if err != nil {
+			return translateError(err)
+		}
+		return s.recordEvents(ctx, tx, userChange{OpUpdate, before, &patched})
+	})
+	if err != nil {
+		log.Printf("Error patching user %d: %v", id, err)
+		return nil, err
+	}
+	log.Printf("Successfully patched user %d", id)
+	return &patched, nil
+}
+
+// DeleteUser мягко удаляет пользователя по ID.
+func (s *PgxStore) DeleteUser(ctx context.Context, id int, version int) error {
+	log.Printf("Deleting user with ID: %d", id)
+	err := s.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := lockUserPgx(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(before, version); err != nil {
+			return err
+		}
+
+		deleted, err := scanUser(tx.QueryRow(ctx, softDeleteUserSQL, id))
+		if err != nil {
+			return translateError(err)
+		}
+		return s.recordEvents(ctx, tx, userChange{OpDelete, before, &deleted})
+	})
+	if err != nil {
+		log.Printf("Error deleting user %d: %v", id, err)
+		return err
+	}
+	log.Printf("Successfully deleted user %d", id)
+	return nil
+}
+
+// RestoreUser восстанавливает мягко удаленного пользователя.
+func (s *PgxStore) RestoreUser(ctx context.Context, id int) (*User, error) {
+	log.Printf("Restoring user with ID: %d", id)
+	var restored User
+	err := s.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := lockUserPgx(ctx, tx, id, true)
+		if err != nil {
+			return err
+		}
+
+		restored, err = scanUser(tx.QueryRow(ctx, restoreUserSQL, id))
+		if err != nil {
+			return translateError(err)
+		}
+		return s.recordEvents(ctx, tx, userChange{OpRestore, before, &restored})
+	})
+	if err != nil {
+		log.Printf("Error restoring user %d: %v", id, err)
+		return nil, err
+	}
+	log.Printf("Successfully restored user %d", id)
+	return &restored, nil
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, мягко удаленных
+// раньше, чем retention назад.
+func (s *PgxStore) PurgeDeletedUsers(ctx context.Context, retention time.Duration) ([]int, error) {
+	log.Printf("Purging users deleted more than %v ago", retention)
+	var ids []int
+	err := s.withTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, purgeUsersSQL, retention.Seconds())
+		if err != nil {
+			return translateError(err)
+		}
+		purged, err := collectUsers(rows, 0)
+		if err != nil {
+			return err
+		}
+		if len(purged) == 0 {
+			return nil
+		}
+
+		changes := make([]userChange, len(purged))
+		for i := range purged {
+			changes[i] = userChange{OpPurge, &purged[i], nil}
+			ids = append(ids, purged[i].ID)
+		}
+		return s.recordEvents(ctx, tx, changes...)
+	})
+	if err != nil {
+		log.Printf("Error purging deleted users: %v", err)
+		return nil, err
+	}
+	log.Printf("Successfully purged %d users", len(ids))
+	return ids, nil
+}
+
+// GetUserHistory возвращает историю изменений пользователя от новых событий
+// к старым. Страница событий и проверка существования пользователя
+// отправляются одним пакетом.
+func (s *PgxStore) GetUserHistory(ctx context.Context, id int, opts HistoryOptions) (*EventPage, error) {
+	opts = opts.Normalize()
+	log.Printf("Fetching history of user %d", id)
+
+	query, args, err := buildHistoryQuery(id, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(query, args...)
+	batch.Queue(userExistsSQL, id)
+	results := s.Pool.SendBatch(ctx, batch)
+	defer results.Close()
+
+	rows, err := results.Query()
+	if err != nil {
+		log.Printf("Error querying history of user %d: %v", id, err)
+		return nil, translateError(err)
+	}
+	events := make([]UserEvent, 0, opts.Limit+1)
+	for rows.Next() {
+		var (
+			e             UserEvent
+			before, after []byte
+		)
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Actor, &e.Operation, &before, &after, &e.CreatedAt); err != nil {
+			rows.Close()
+			log.Printf("Error scanning user event row: %v", err)
+			return nil, translateError(err)
+		}
+		e.Before, e.After = before, after
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating user events: %v", err)
+		return nil, translateError(err)
+	}
+
+	var exists bool
+	if err := results.QueryRow().Scan(&exists); err != nil {
+		return nil, translateError(err)
+	}
+	if len(events) == 0 && opts.Cursor == "" && !exists {
+		return nil, errUserNotFound(id)
+	}
+
+	return newEventPage(events, opts), nil
+}
+
+// withTx выполняет fn в транзакции и фиксирует ее, если fn не вернула ошибку.
+func (s *PgxStore) withTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return translateError(err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback(ctx)
+		return err
+	}
+	return translateError(tx.Commit(ctx))
+}
+
+// userChange описывает одно изменение пользователя для записи в историю и outbox.
+type userChange struct {
+	op            string
+	before, after *User
+}
+
+// recordEvents записывает события истории и outbox для изменений одним пакетом.
+func (s *PgxStore) recordEvents(ctx context.Context, tx pgx.Tx, changes ...userChange) error {
+	batch := &pgx.Batch{}
+	for _, ch := range changes {
+		state := ch.after
+		if state == nil {
+			state = ch.before
+		}
+		auditArgs, outboxArgs, err := eventArgs(ctx, state.ID, ch.op, ch.before, ch.after)
+		if err != nil {
+			return err
+		}
+		batch.Queue(insertUserEventSQL, auditArgs...)
+		batch.Queue(insertOutboxSQL, outboxArgs...)
+	}
+	return translateError(tx.SendBatch(ctx, batch).Close())
+}
+
+// lockUserPgx читает пользователя и блокирует строку до конца транзакции.
+// deleted выбирает мягко удаленных пользователей вместо активных.
+func lockUserPgx(ctx context.Context, tx pgx.Tx, id int, deleted bool) (*User, error) {
+	u, err := scanUser(tx.QueryRow(ctx, lockUserSQL(deleted), id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, lockedUserNotFound(id, deleted)
+		}
+		return nil, translateError(err)
+	}
+	return &u, nil
+}
+
+// collectUsers читает все строки, выбранные по userColumns, и закрывает rows.
+func collectUsers(rows pgx.Rows, capacity int) ([]User, error) {
+	defer rows.Close()
+
+	users := make([]User, 0, capacity)
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, translateError(err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+	return users, nil
+}
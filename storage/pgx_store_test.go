@@ -0,0 +1,326 @@
+package storage_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/avetis74/12_app_factors/storage/storagetest"
+)
+
+// benchEmailPattern отмечает пользователей, созданных бенчмарками, для очистки.
+const benchEmailPattern = "storebench-%@example.com"
+
+// openTestPgxStore открывает PgxStore поверх пула к тестовой БД.
+func openTestPgxStore(tb testing.TB) *storage.PgxStore {
+	tb.Helper()
+	pool, err := storage.NewPgxPool(context.Background(), testDatabaseURL(tb))
+	if err != nil {
+		tb.Fatalf("test database is not reachable: %v", err)
+	}
+	tb.Cleanup(pool.Close)
+	return storage.NewPgxStore(pool)
+}
+
+// benchStore — хранилище, которое сравнивается в бенчмарках.
+type benchStore struct {
+	driver string
+	store  storage.UserStore
+}
+
+// benchStores возвращает PostgresStore и PgxStore для сравнения драйверов
+// и удаляет созданных бенчмарком пользователей после завершения.
+func benchStores(b *testing.B) []benchStore {
+	db := openTestDB(b)
+	pgx := openTestPgxStore(b)
+	b.Cleanup(func() { cleanupBench(db) })
+
+	// Логи хранилищ искажали бы измерения
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	return []benchStore{
+		{"pq", storage.NewPostgresStore(db)},
+		{"pgx", pgx},
+	}
+}
+
+var benchSeq atomic.Int64
+
+// newBenchUser возвращает пользователя с уникальным email.
+func newBenchUser() *storage.User {
+	seq := benchSeq.Add(1)
+	return &storage.User{
+		Name:  fmt.Sprintf("Bench User %d", seq),
+		Email: fmt.Sprintf("storebench-%d-%d@example.com", time.Now().UnixNano(), seq),
+	}
+}
+
+// seedUsers создает n пользователей для бенчмарков чтения.
+func seedUsers(b *testing.B, store storage.UserStore, n int) []int {
+	b.Helper()
+	ids := make([]int, n)
+	for i := range ids {
+		u := newBenchUser()
+		if err := store.CreateUser(context.Background(), u); err != nil {
+			b.Fatalf("seed user: %v", err)
+		}
+		ids[i] = u.ID
+	}
+	return ids
+}
+
+// cleanupBench удаляет пользователей, созданных бенчмарками, и их события.
+func cleanupBench(db *sql.DB) {
+	for _, query := range []string{
+		"DELETE FROM outbox WHERE user_id IN (SELECT id FROM users WHERE email LIKE $1)",
+		"DELETE FROM user_events WHERE user_id IN (SELECT id FROM users WHERE email LIKE $1)",
+		"DELETE FROM users WHERE email LIKE $1",
+	} {
+		if _, err := db.Exec(query, benchEmailPattern); err != nil {
+			log.Printf("Error cleaning up benchmark data: %v", err)
+		}
+	}
+}
+
+// Бенчмарки сравнивают PostgresStore (lib/pq) и PgxStore (pgx) на одинаковых
+// операциях: go test -bench . -run '^$' ./storage с TEST_DATABASE_URL.
+
+func BenchmarkCreateUser(b *testing.B) {
+	ctx := context.Background()
+	for _, s := range benchStores(b) {
+		b.Run(s.driver, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := s.store.CreateUser(ctx, newBenchUser()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetUser(b *testing.B) {
+	ctx := context.Background()
+	for _, s := range benchStores(b) {
+		b.Run(s.driver, func(b *testing.B) {
+			ids := seedUsers(b, s.store, 10)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.store.GetUser(ctx, ids[i%len(ids)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkListUsers(b *testing.B) {
+	ctx := context.Background()
+	for _, s := range benchStores(b) {
+		b.Run(s.driver, func(b *testing.B) {
+			seedUsers(b, s.store, storage.DefaultPageSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.store.ListUsers(ctx, storage.ListOptions{EmailPrefix: "storebench-"}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUpdateUser(b *testing.B) {
+	ctx := context.Background()
+	for _, s := range benchStores(b) {
+		b.Run(s.driver, func(b *testing.B) {
+			ids := seedUsers(b, s.store, 1)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := s.store.UpdateUser(ctx, ids[0], newBenchUser()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetUserHistory(b *testing.B) {
+	ctx := context.Background()
+	for _, s := range benchStores(b) {
+		b.Run(s.driver, func(b *testing.B) {
+			ids := seedUsers(b, s.store, 1)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.store.GetUserHistory(ctx, ids[0], storage.HistoryOptions{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// PostgresStore не умеет пакетное чтение и COPY, поэтому в следующих
+// бенчмарках ему соответствуют те же операции по одной строке за обмен.
+
+func BenchmarkGetUsersByIDs(b *testing.B) {
+	ctx := context.Background()
+	stores := benchStores(b)
+	pq, pgx := stores[0].store, stores[1].store.(*storage.PgxStore)
+
+	b.Run("pq", func(b *testing.B) {
+		ids := seedUsers(b, pq, storage.DefaultPageSize)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, id := range ids {
+				if _, err := pq.GetUser(ctx, id); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("pgx", func(b *testing.B) {
+		ids := seedUsers(b, pgx, storage.DefaultPageSize)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := pgx.GetUsersByIDs(ctx, ids); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// bulkSize — число пользователей, создаваемых за одну итерацию BenchmarkBulkCreateUsers.
+const bulkSize = 100
+
+func BenchmarkBulkCreateUsers(b *testing.B) {
+	ctx := context.Background()
+	stores := benchStores(b)
+	pq, pgx := stores[0].store, stores[1].store.(*storage.PgxStore)
+
+	b.Run("pq", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < bulkSize; j++ {
+				if err := pq.CreateUser(ctx, newBenchUser()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("pgx", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			users := make([]*storage.User, bulkSize)
+			for j := range users {
+				users[j] = newBenchUser()
+			}
+			if err := pgx.BulkCreateUsers(ctx, users); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestPgxStore(t *testing.T) {
+	store := openTestPgxStore(t)
+	storagetest.TestUserStore(t, func(t *testing.T) storage.UserStore {
+		return store
+	})
+}
+
+func TestPgxStoreGetUsersByIDs(t *testing.T) {
+	ctx := context.Background()
+	store := openTestPgxStore(t)
+	db := openTestDB(t)
+	t.Cleanup(func() { cleanupBench(db) })
+
+	first, second := newBenchUser(), newBenchUser()
+	for _, u := range []*storage.User{first, second} {
+		if err := store.CreateUser(ctx, u); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+	deleted := newBenchUser()
+	if err := store.CreateUser(ctx, deleted); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := store.DeleteUser(ctx, deleted.ID, 0); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	users, err := store.GetUsersByIDs(ctx, []int{second.ID, 0, deleted.ID, first.ID})
+	if err != nil {
+		t.Fatalf("GetUsersByIDs: %v", err)
+	}
+	if len(users) != 2 || users[0].ID != second.ID || users[1].ID != first.ID {
+		t.Fatalf("GetUsersByIDs = %+v, want users %d and %d in request order", users, second.ID, first.ID)
+	}
+	if users[0].Email != second.Email || users[0].Status != storage.StatusActive {
+		t.Errorf("GetUsersByIDs()[0] = %+v, want %+v", users[0], *second)
+	}
+
+	users, err = store.GetUsersByIDs(ctx, nil)
+	if err != nil || len(users) != 0 {
+		t.Errorf("GetUsersByIDs(nil) = %v, %v; want empty result", users, err)
+	}
+}
+
+func TestPgxStoreBulkCreateUsers(t *testing.T) {
+	ctx := context.Background()
+	store := openTestPgxStore(t)
+	db := openTestDB(t)
+	t.Cleanup(func() { cleanupBench(db) })
+
+	users := []*storage.User{newBenchUser(), newBenchUser(), newBenchUser()}
+	users[2].Status = storage.StatusInactive
+	if err := store.BulkCreateUsers(ctx, users); err != nil {
+		t.Fatalf("BulkCreateUsers: %v", err)
+	}
+	for i, u := range users {
+		if u.ID == 0 || u.Version == 0 || u.CreatedAt.IsZero() {
+			t.Fatalf("users[%d] = %+v, want ID, version and timestamps filled in", i, *u)
+		}
+		if i > 0 && u.ID <= users[i-1].ID {
+			t.Errorf("users[%d].ID = %d, want IDs in input order", i, u.ID)
+		}
+		got, err := store.GetUser(ctx, u.ID)
+		if err != nil {
+			t.Fatalf("GetUser(%d): %v", u.ID, err)
+		}
+		if got.Email != u.Email || got.Status != u.Status {
+			t.Errorf("GetUser(%d) = %+v, want %+v", u.ID, *got, *u)
+		}
+	}
+	if users[0].Status != storage.StatusActive {
+		t.Errorf("users[0].Status = %q, want default %q", users[0].Status, storage.StatusActive)
+	}
+
+	history, err := store.GetUserHistory(ctx, users[0].ID, storage.HistoryOptions{})
+	if err != nil {
+		t.Fatalf("GetUserHistory: %v", err)
+	}
+	if len(history.Events) != 1 || history.Events[0].Operation != storage.OpCreate {
+		t.Errorf("GetUserHistory = %+v, want one create event", history.Events)
+	}
+
+	// Дубликат email откатывает всю загрузку
+	fresh := newBenchUser()
+	dup := &storage.User{Name: "Duplicate", Email: users[1].Email}
+	err = store.BulkCreateUsers(ctx, []*storage.User{fresh, dup})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("BulkCreateUsers with duplicate email: err = %v, want ErrConflict", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM users WHERE email = $1", fresh.Email).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("BulkCreateUsers created %d users after a conflict, want none", count)
+	}
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SQL-запросы к PostgreSQL, общие для драйверов lib/pq и pgx.
+const (
+	insertUserSQL = "INSERT INTO users (name, email, status) VALUES ($1, $2, $3) RETURNING " + userColumns
+
+	selectUserSQL = "SELECT " + userColumns + " FROM users WHERE id = $1 AND deleted_at IS NULL"
+
+	updateUserSQL = "UPDATE users SET name = $1, email = $2, status = $3, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = $4 RETURNING " + userColumns
+
+	softDeleteUserSQL = "UPDATE users SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = $1 RETURNING " + userColumns
+
+	restoreUserSQL = "UPDATE users SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = $1 RETURNING " + userColumns
+
+	purgeUsersSQL = "DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < CURRENT_TIMESTAMP - make_interval(secs => $1) RETURNING " + userColumns
+
+	userExistsSQL = "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)"
+
+	insertUserEventSQL = "INSERT INTO user_events (user_id, actor, operation, before, after) VALUES ($1, $2, $3, $4, $5)"
+
+	insertOutboxSQL = "INSERT INTO outbox (user_id, event_type, payload) VALUES ($1, $2, $3)"
+)
+
+// lockUserSQL возвращает запрос, который читает пользователя и блокирует
+// строку до конца транзакции. deleted выбирает мягко удаленных пользователей.
+func lockUserSQL(deleted bool) string {
+	cond := "deleted_at IS NULL"
+	if deleted {
+		cond = "deleted_at IS NOT NULL"
+	}
+	return "SELECT " + userColumns + " FROM users WHERE id = $1 AND " + cond + " FOR UPDATE"
+}
+
+// lockedUserNotFound возвращает ошибку для lockUserSQL, не нашедшего строку.
+func lockedUserNotFound(id int, deleted bool) error {
+	if deleted {
+		return fmt.Errorf("deleted user with id %d %w", id, ErrNotFound)
+	}
+	return errUserNotFound(id)
+}
+
+// buildListQuery строит запрос страницы пользователей по нормализованным
+// параметрам. Запрашивается на одну запись больше, чтобы понять, есть ли
+// следующая страница.
+func buildListQuery(opts ListOptions) (string, []interface{}, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	addCond := func(format string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(format, len(args)))
+	}
+
+	if !opts.IncludeDeleted {
+		conds = append(conds, "deleted_at IS NULL")
+	}
+	if opts.Status != "" {
+		addCond("status = $%d", opts.Status)
+	}
+	if opts.EmailPrefix != "" {
+		addCond("lower(email) LIKE $%d", likePrefix(opts.EmailPrefix))
+	}
+	if opts.NamePrefix != "" {
+		addCond("lower(name) LIKE $%d", likePrefix(opts.NamePrefix))
+	}
+
+	order := "ASC"
+	if opts.Sort == SortByIDDesc {
+		order = "DESC"
+	}
+	if opts.Cursor != "" {
+		lastID, err := decodeCursor(opts.Cursor, opts.Sort)
+		if err != nil {
+			return "", nil, err
+		}
+		if opts.Sort == SortByIDDesc {
+			addCond("id < $%d", lastID)
+		} else {
+			addCond("id > $%d", lastID)
+		}
+	}
+
+	query := "SELECT " + userColumns + " FROM users"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, opts.Limit+1)
+	query += fmt.Sprintf(" ORDER BY id %s LIMIT $%d", order, len(args))
+	return query, args, nil
+}
+
+// newUserPage обрезает выборку из buildListQuery до размера страницы
+// и вычисляет курсор следующей страницы.
+func newUserPage(users []User, opts ListOptions) *UserPage {
+	page := &UserPage{Users: users}
+	if len(users) > opts.Limit {
+		page.Users = users[:opts.Limit]
+		page.NextCursor = encodeCursor(page.Users[opts.Limit-1].ID, opts.Sort)
+	}
+	return page
+}
+
+// buildPatchQuery строит UPDATE, изменяющий только переданные в патче колонки.
+func buildPatchQuery(id int, patch UserPatch) (string, []interface{}) {
+	var (
+		sets []string
+		args []interface{}
+	)
+	addSet := func(column string, value string) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if patch.Name != nil {
+		addSet("name", *patch.Name)
+	}
+	if patch.Email != nil {
+		addSet("email", *patch.Email)
+	}
+	if patch.Status != nil {
+		addSet("status", *patch.Status)
+	}
+	args = append(args, id)
+
+	query := fmt.Sprintf("UPDATE users SET %s, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = $%d RETURNING %s",
+		strings.Join(sets, ", "), len(args), userColumns)
+	return query, args
+}
+
+// buildHistoryQuery строит запрос страницы истории пользователя
+// по нормализованным параметрам (от новых событий к старым).
+func buildHistoryQuery(id int, opts HistoryOptions) (string, []interface{}, error) {
+	args := []interface{}{id}
+	query := "SELECT id, user_id, actor, operation, before, after, created_at FROM user_events WHERE user_id = $1"
+	if opts.Cursor != "" {
+		lastID, err := decodeCursor(opts.Cursor, SortByIDDesc)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, lastID)
+		query += " AND id < $2"
+	}
+	args = append(args, opts.Limit+1)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+	return query, args, nil
+}
+
+// newEventPage обрезает выборку из buildHistoryQuery до размера страницы
+// и вычисляет курсор следующей страницы.
+func newEventPage(events []UserEvent, opts HistoryOptions) *EventPage {
+	page := &EventPage{Events: events}
+	if len(events) > opts.Limit {
+		page.Events = events[:opts.Limit]
+		page.NextCursor = encodeCursor(page.Events[opts.Limit-1].ID, SortByIDDesc)
+	}
+	return page
+}
+
+// eventArgs возвращает аргументы insertUserEventSQL и insertOutboxSQL
+// для изменения пользователя.
+func eventArgs(ctx context.Context, userID int, op string, before, after *User) (audit []interface{}, outbox []interface{}, err error) {
+	diffBefore, diffAfter := userDiff(before, after)
+	audit = []interface{}{userID, ActorFromContext(ctx), op, nullJSON(diffBefore), nullJSON(diffAfter)}
+
+	payload, err := newOutboxPayload(ctx, op, before, after)
+	if err != nil {
+		return nil, nil, err
+	}
+	outbox = []interface{}{userID, outboxEventType(op), payload}
+	return audit, outbox, nil
+}
+
+// checkVersion проверяет ожидаемую версию пользователя; 0 отключает проверку.
+func checkVersion(u *User, expected int) error {
+	if expected != 0 && u.Version != expected {
+		return errVersionMismatch(u.ID)
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrCacheUnavailable возвращается кешем, который временно отключен
+// из-за недоступности Redis.
+var ErrCacheUnavailable = errors.New("cache unavailable")
+
+// CacheHealth — необязательный интерфейс CacheService, сообщающий,
+// доступен ли кеш. CachedUserStore не обращается к недоступному кешу.
+type CacheHealth interface {
+	Available() bool
+}
+
+// Состояния кеша в CacheStatus.
+const (
+	CacheStateAvailable = "available"
+	CacheStateDegraded  = "degraded"
+)
+
+// CacheStatus описывает состояние ReconnectingCache для проверки здоровья.
+type CacheStatus struct {
+	State string `json:"state"`
+	// Since — время последней смены состояния.
+	Since     time.Time `json:"since"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// ReconnectingCache — CacheService поверх Redis, который не требует
+// доступности Redis при запуске. Пока Redis недоступен, операции сразу
+// возвращают ErrCacheUnavailable, а Run проверяет подключение с
+// экспоненциальной задержкой. Ошибка соединения в любой операции переводит
+// кеш в недоступное состояние до следующей успешной проверки.
+type ReconnectingCache struct {
+	redis *RedisCache
+
+	mu        sync.RWMutex
+	available bool
+	checked   bool
+	since     time.Time
+	lastErr   error
+
+	// wake прерывает ожидание в Run после ошибки соединения.
+	wake chan struct{}
+
+	// MinBackoff и MaxBackoff ограничивают задержку между попытками
+	// подключения к недоступному Redis.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// CheckInterval — период проверки доступного Redis.
+	CheckInterval time.Duration
+	// OnReconnect вызывается после восстановления доступа к Redis. Пока кеш
+	// был недоступен, изменения не сбрасывали его, поэтому здесь нужно
+	// удалить все значения, которые могли устареть.
+	OnReconnect func(ctx context.Context)
+}
+
+// NewReconnectingCache создает кеш для Redis по адресу redisURL без проверки
+// подключения. Ошибка возвращается только для некорректного адреса.
+func NewReconnectingCache(redisURL string) (*ReconnectingCache, error) {
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+	}
+	return &ReconnectingCache{
+		redis:         &RedisCache{client: redis.NewClient(opt)},
+		since:         time.Now(),
+		wake:          make(chan struct{}, 1),
+		MinBackoff:    time.Second,
+		MaxBackoff:    30 * time.Second,
+		CheckInterval: 5 * time.Second,
+	}, nil
+}
+
+// Redis возвращает RedisCache, через который идут операции.
+func (c *ReconnectingCache) Redis() *RedisCache {
+	return c.redis
+}
+
+// Available сообщает, доступен ли Redis по результатам последней проверки.
+func (c *ReconnectingCache) Available() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.available
+}
+
+// Status возвращает текущее состояние кеша.
+func (c *ReconnectingCache) Status() CacheStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	status := CacheStatus{State: CacheStateDegraded, Since: c.since}
+	if c.available {
+		status.State = CacheStateAvailable
+	}
+	if c.lastErr != nil {
+		status.LastError = c.lastErr.Error()
+	}
+	return status
+}
+
+// Check проверяет подключение к Redis и обновляет состояние кеша.
+func (c *ReconnectingCache) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	if err := c.redis.client.Ping(ctx).Err(); err != nil {
+		c.markDown(err)
+		return err
+	}
+	c.markUp(ctx)
+	return nil
+}
+
+// Run периодически проверяет Redis, пока не будет отменен контекст.
+func (c *ReconnectingCache) Run(ctx context.Context) {
+	backoff := c.MinBackoff
+	for {
+		wait := c.CheckInterval
+		if err := c.Check(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			wait = backoff
+			backoff = min(backoff*2, c.MaxBackoff)
+		} else {
+			backoff = c.MinBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.wake:
+			// Ошибка соединения в операции: проверяем сразу, затем с задержкой
+			backoff = c.MinBackoff
+		case <-time.After(wait):
+		}
+	}
+}
+
+// markUp отмечает Redis доступным и при восстановлении вызывает OnReconnect.
+func (c *ReconnectingCache) markUp(ctx context.Context) {
+	c.mu.Lock()
+	first := !c.checked
+	recovered := c.checked && !c.available
+	if !c.available {
+		c.since = time.Now()
+	}
+	c.available, c.checked, c.lastErr = true, true, nil
+	c.mu.Unlock()
+
+	if recovered {
+		log.Println("Redis connection restored, caching enabled")
+		if c.OnReconnect != nil {
+			c.OnReconnect(context.WithoutCancel(ctx))
+		}
+	} else if first {
+		log.Println("Redis connection successful")
+	}
+}
+
+// markDown отмечает Redis недоступным.
+func (c *ReconnectingCache) markDown(err error) {
+	c.mu.Lock()
+	wasAvailable := c.available || !c.checked
+	if c.available {
+		c.since = time.Now()
+	}
+	c.available, c.checked, c.lastErr = false, true, err
+	c.mu.Unlock()
+
+	if wasAvailable {
+		log.Printf("Redis is unavailable, caching disabled: %v", err)
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// observe переводит кеш в недоступное состояние при ошибке соединения.
+// Ошибка после отмены или истечения контекста вызывающего — например,
+// клиент отключился или запрос превысил свой срок — говорит о запросе,
+// а не о Redis, и состояние кеша не меняет.
+func (c *ReconnectingCache) observe(ctx context.Context, err error) error {
+	if ctx.Err() == nil && isConnError(err) {
+		c.markDown(err)
+	}
+	return err
+}
+
+// Set сохраняет значение в кеше
+func (c *ReconnectingCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	if !c.Available() {
+		return ErrCacheUnavailable
+	}
+	return c.observe(ctx, c.redis.Set(ctx, key, value, expiration))
+}
+
+// Get получает значение из кеша
+func (c *ReconnectingCache) Get(ctx context.Context, key string, dest interface{}) error {
+	if !c.Available() {
+		return ErrCacheUnavailable
+	}
+	return c.observe(ctx, c.redis.Get(ctx, key, dest))
+}
+
+// Delete удаляет ключ из кеша
+func (c *ReconnectingCache) Delete(ctx context.Context, key string) error {
+	if !c.Available() {
+		return ErrCacheUnavailable
+	}
+	return c.observe(ctx, c.redis.Delete(ctx, key))
+}
+
+// DeletePattern удаляет все ключи по паттерну
+func (c *ReconnectingCache) DeletePattern(ctx context.Context, pattern string) error {
+	if !c.Available() {
+		return ErrCacheUnavailable
+	}
+	return c.observe(ctx, c.redis.DeletePattern(ctx, pattern))
+}
+
+// InvalidateNamespace сбрасывает все ключи пространства имен
+func (c *ReconnectingCache) InvalidateNamespace(ctx context.Context, namespace string) error {
+	if !c.Available() {
+		return ErrCacheUnavailable
+	}
+	return c.observe(ctx, c.redis.InvalidateNamespace(ctx, namespace))
+}
+
+// Close закрывает соединение с Redis
+func (c *ReconnectingCache) Close() error {
+	return c.redis.Close()
+}
+
+// isConnError сообщает, что ошибка Redis вызвана недоступностью сервера,
+// а не отсутствием ключа или данными. Истечение срока здесь — таймаут самой
+// операции Redis; ошибки контекста вызывающего отсекает observe.
+func isConnError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, redis.ErrClosed) ||
+		errors.Is(err, redis.ErrPoolTimeout)
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// unreachableRedisURL возвращает адрес Redis, соединения с которым
+// отклоняются: порт только что освобожден.
+func unreachableRedisURL(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return "redis://" + addr
+}
+
+func TestReconnectingCacheIgnoresCallerContextErrors(t *testing.T) {
+	c, err := NewReconnectingCache(unreachableRedisURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.markUp(context.Background())
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	for name, ctx := range map[string]context.Context{"canceled": canceled, "deadline exceeded": expired} {
+		var v string
+		if err := c.Get(ctx, "user:1", &v); err == nil {
+			t.Fatalf("Get(%s ctx) succeeded against unreachable Redis", name)
+		}
+		if !c.Available() {
+			t.Fatalf("Get(%s ctx) marked the cache unavailable, want only Redis errors to count", name)
+		}
+	}
+
+	// Ошибка соединения при живом контексте вызывающего переводит кеш
+	// в недоступное состояние
+	var v string
+	if err := c.Get(context.Background(), "user:1", &v); err == nil {
+		t.Fatal("Get succeeded against unreachable Redis")
+	}
+	if c.Available() {
+		t.Fatal("connection error did not mark the cache unavailable")
+	}
+	if status := c.Status(); status.State != CacheStateDegraded || status.LastError == "" {
+		t.Errorf("Status() = %+v, want degraded with the last error", status)
+	}
+}
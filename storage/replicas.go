@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// replicaLagQuery возвращает, отключен ли прием WAL, и отставание реплики
+// в секундах. Прием считается отключенным, если WAL receiver не в состоянии
+// streaming или не получал сообщений от основного сервера дольше $1 секунд:
+// такая реплика применила все полученные WAL, но новых не получает. Если
+// прием работает и реплика применила все полученные WAL, отставание считается
+// нулевым, даже если последняя транзакция была давно. На основном сервере
+// запрос возвращает false и 0.
+const replicaLagQuery = `SELECT
+	pg_is_in_recovery() AND NOT EXISTS (
+		SELECT 1 FROM pg_stat_wal_receiver
+		WHERE status = 'streaming' AND last_msg_receipt_time > now() - make_interval(secs => $1)
+	),
+	CASE
+		WHEN NOT pg_is_in_recovery() THEN 0
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END`
+
+// errReceiverStopped — реплика не получает WAL от основного сервера.
+var errReceiverStopped = errors.New("WAL receiver is not streaming")
+
+// lagProbe возвращает текущее отставание реплики.
+type lagProbe func(ctx context.Context, db *sql.DB) (time.Duration, error)
+
+// replica — одна реплика для чтения и ее последнее известное состояние.
+type replica struct {
+	name    string
+	db      *sql.DB
+	healthy atomic.Bool
+	lag     atomic.Int64 // наносекунды
+}
+
+// ReplicaStatus описывает состояние реплики для health-проверок.
+type ReplicaStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Lag     string `json:"lag"`
+}
+
+// ReplicaSet распределяет чтение по исправным репликам. Реплика исключается
+// из ротации, если она недоступна, не получает WAL или ее отставание
+// превышает MaxLag.
+type ReplicaSet struct {
+	replicas      []*replica
+	next          atomic.Uint64
+	MaxLag        time.Duration
+	CheckInterval time.Duration
+	// MaxReceiverIdle — сколько WAL receiver реплики может не получать
+	// сообщений от основного сервера, прежде чем прием считается оборванным.
+	// Не должно быть меньше wal_receiver_timeout / 2: на простаивающем
+	// сервере реплика запрашивает ответ только с таким интервалом.
+	MaxReceiverIdle time.Duration
+	// probe измеряет отставание; nil — запрос replicaLagQuery.
+	probe lagProbe
+}
+
+// NewReplicaSet открывает пулы соединений к репликам по списку URL.
+// До первой проверки все реплики считаются неисправными.
+func NewReplicaSet(urls []string) (*ReplicaSet, error) {
+	rs := &ReplicaSet{
+		MaxLag:          5 * time.Second,
+		CheckInterval:   2 * time.Second,
+		MaxReceiverIdle: time.Minute,
+	}
+	for _, u := range urls {
+		db, err := sql.Open("postgres", u)
+		if err != nil {
+			rs.Close()
+			return nil, fmt.Errorf("failed to open replica %s: %w", redactURL(u), err)
+		}
+		rs.replicas = append(rs.replicas, &replica{name: redactURL(u), db: db})
+	}
+	return rs, nil
+}
+
+// Run периодически проверяет доступность и отставание реплик,
+// пока не будет отменен контекст.
+func (rs *ReplicaSet) Run(ctx context.Context) {
+	rs.CheckAll(ctx)
+	ticker := time.NewTicker(rs.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rs.CheckAll(ctx)
+		}
+	}
+}
+
+// CheckAll проверяет все реплики и обновляет их состояние.
+func (rs *ReplicaSet) CheckAll(ctx context.Context) {
+	for _, r := range rs.replicas {
+		checkCtx, cancel := context.WithTimeout(ctx, rs.CheckInterval)
+		lag, err := rs.measureLag(checkCtx, r.db)
+		cancel()
+
+		healthy := err == nil && lag <= rs.MaxLag
+		r.lag.Store(int64(lag))
+
+		if was := r.healthy.Swap(healthy); was != healthy {
+			switch {
+			case err != nil:
+				log.Printf("Replica %s removed from rotation: %v", r.name, err)
+			case !healthy:
+				log.Printf("Replica %s removed from rotation: lag %v exceeds %v", r.name, lag, rs.MaxLag)
+			default:
+				log.Printf("Replica %s added to rotation (lag %v)", r.name, lag)
+			}
+		}
+	}
+}
+
+// measureLag возвращает отставание реплики через probe или replicaLagQuery.
+func (rs *ReplicaSet) measureLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	if rs.probe != nil {
+		return rs.probe(ctx, db)
+	}
+	return rs.queryLag(ctx, db)
+}
+
+// queryLag измеряет отставание реплики запросом replicaLagQuery.
+func (rs *ReplicaSet) queryLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	var stopped bool
+	var lagSeconds float64
+	err := db.QueryRowContext(ctx, replicaLagQuery, rs.MaxReceiverIdle.Seconds()).Scan(&stopped, &lagSeconds)
+	if err != nil {
+		return 0, err
+	}
+	if stopped {
+		return 0, errReceiverStopped
+	}
+	return time.Duration(lagSeconds * float64(time.Second)), nil
+}
+
+// Pick возвращает следующую исправную реплику по кругу или nil,
+// если исправных реплик нет.
+func (rs *ReplicaSet) Pick() *sql.DB {
+	n := len(rs.replicas)
+	start := rs.next.Add(1)
+	for i := 0; i < n; i++ {
+		r := rs.replicas[(start+uint64(i))%uint64(n)]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+	return nil
+}
+
+// Status возвращает состояние всех реплик.
+func (rs *ReplicaSet) Status() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, 0, len(rs.replicas))
+	for _, r := range rs.replicas {
+		statuses = append(statuses, ReplicaStatus{
+			Name:    r.name,
+			Healthy: r.healthy.Load(),
+			Lag:     time.Duration(r.lag.Load()).String(),
+		})
+	}
+	return statuses
+}
+
+// Close закрывает соединения со всеми репликами.
+func (rs *ReplicaSet) Close() error {
+	var firstErr error
+	for _, r := range rs.replicas {
+		if err := r.db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+type primaryKey struct{}
+
+// WithPrimary помечает контекст так, что чтение выполняется на основном
+// сервере. Используется для гарантии read-your-writes сразу после записи.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// usePrimary сообщает, что чтение должно идти на основной сервер.
+func usePrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryKey{}).(bool)
+	return v
+}
+
+// redactURL убирает пароль из URL для логов.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "replica"
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+// probeResult — ответ фальшивой проверки отставания для одной реплики.
+type probeResult struct {
+	lag time.Duration
+	err error
+}
+
+// newTestReplicaSet создает ReplicaSet из трех реплик, отставание которых
+// берется из results по имени реплики. Соединения с БД не открываются.
+func newTestReplicaSet(t *testing.T, results map[string]probeResult) *ReplicaSet {
+	t.Helper()
+	rs, err := NewReplicaSet([]string{
+		"postgres://healthy.invalid/app",
+		"postgres://lagging.invalid/app",
+		"postgres://unreachable.invalid/app",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rs.Close() })
+
+	names := make(map[*sql.DB]string)
+	for _, r := range rs.replicas {
+		names[r.db] = r.name
+	}
+	rs.probe = func(ctx context.Context, db *sql.DB) (time.Duration, error) {
+		res := results[names[db]]
+		return res.lag, res.err
+	}
+	return rs
+}
+
+// replicaDB возвращает пул реплики с указанным именем.
+func replicaDB(t *testing.T, rs *ReplicaSet, name string) *sql.DB {
+	t.Helper()
+	for _, r := range rs.replicas {
+		if r.name == name {
+			return r.db
+		}
+	}
+	t.Fatalf("no replica %s", name)
+	return nil
+}
+
+func TestReplicaSetRoutesOnlyToHealthyReplicas(t *testing.T) {
+	const (
+		healthy     = "postgres://healthy.invalid/app"
+		lagging     = "postgres://lagging.invalid/app"
+		unreachable = "postgres://unreachable.invalid/app"
+	)
+	results := map[string]probeResult{
+		healthy:     {lag: time.Second},
+		lagging:     {lag: time.Minute},
+		unreachable: {err: errors.New("connection refused")},
+	}
+	rs := newTestReplicaSet(t, results)
+
+	if db := rs.Pick(); db != nil {
+		t.Fatal("Pick() before the first check returned a replica, want nil")
+	}
+
+	rs.CheckAll(context.Background())
+	want := replicaDB(t, rs, healthy)
+	for i := 0; i < 6; i++ {
+		if db := rs.Pick(); db != want {
+			t.Fatalf("Pick() #%d returned a lagging or unreachable replica", i)
+		}
+	}
+
+	statuses := rs.Status()
+	wantStatus := map[string]bool{healthy: true, lagging: false, unreachable: false}
+	for _, s := range statuses {
+		if s.Healthy != wantStatus[s.Name] {
+			t.Errorf("Status(%s).Healthy = %v, want %v", s.Name, s.Healthy, wantStatus[s.Name])
+		}
+		if s.Name == lagging && s.Lag != time.Minute.String() {
+			t.Errorf("Status(%s).Lag = %s, want %s", s.Name, s.Lag, time.Minute)
+		}
+	}
+
+	// Реплика, у которой оборвался прием WAL, исключается, даже если
+	// она успела применить все полученное
+	results[healthy] = probeResult{err: errReceiverStopped}
+	rs.CheckAll(context.Background())
+	if db := rs.Pick(); db != nil {
+		t.Fatal("Pick() with no healthy replicas returned a replica, want nil")
+	}
+
+	// Догнавшая реплика возвращается в ротацию
+	results[lagging] = probeResult{lag: rs.MaxLag}
+	rs.CheckAll(context.Background())
+	if db := rs.Pick(); db != replicaDB(t, rs, lagging) {
+		t.Fatal("Pick() did not return the replica that caught up")
+	}
+}
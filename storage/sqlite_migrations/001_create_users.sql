@@ -0,0 +1,28 @@
+-- Migration: Create users table (SQLite)
+-- Version: 001
+-- Description: Users table equivalent to PostgreSQL migrations 001-005 (status, version, soft delete)
+
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(255) NOT NULL CHECK (length(name) <= 255),
+    email VARCHAR(255) NOT NULL CHECK (length(email) <= 255),
+    status VARCHAR(20) DEFAULT 'active' NOT NULL CHECK (length(status) <= 20),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')) NOT NULL,
+    updated_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')) NOT NULL,
+    version INTEGER DEFAULT 1 NOT NULL,
+    deleted_at TIMESTAMP
+);
+
+-- Фильтр по статусу с постраничной выборкой по id
+CREATE INDEX IF NOT EXISTS idx_users_status_id ON users(status, id);
+
+-- Поиск пользователей для окончательного удаления по истечении срока хранения
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Email удаленного пользователя можно использовать повторно
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_active_key ON users(email) WHERE deleted_at IS NULL;
+
+-- Insert initial test data
+INSERT OR IGNORE INTO users (name, email) VALUES
+    ('Alice', 'alice@example.com'),
+    ('Bob', 'bob@example.com');
@@ -0,0 +1,17 @@
+-- Migration: Create user events table (SQLite)
+-- Version: 002
+-- Description: Audit history of user changes, equivalent to PostgreSQL migration 006
+
+CREATE TABLE IF NOT EXISTS user_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    -- Без внешнего ключа: история сохраняется и после окончательного удаления
+    user_id INTEGER NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    operation VARCHAR(20) NOT NULL,
+    before TEXT,
+    after TEXT,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')) NOT NULL
+);
+
+-- Постраничная выборка истории пользователя от новых событий к старым
+CREATE INDEX IF NOT EXISTS idx_user_events_user_id ON user_events(user_id, id DESC);
@@ -0,0 +1,510 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLiteScheme — схема DATABASE_URL, выбирающая SQLite вместо PostgreSQL:
+// sqlite://users.db (относительный путь), sqlite:///var/lib/users.db
+// (абсолютный) или sqlite://:memory: (в памяти процесса).
+const SQLiteScheme = "sqlite://"
+
+// IsSQLiteURL сообщает, что адрес выбирает хранилище SQLite.
+func IsSQLiteURL(url string) bool {
+	return strings.HasPrefix(url, SQLiteScheme)
+}
+
+//go:embed sqlite_migrations/*.sql
+var sqliteMigrations embed.FS
+
+// sqliteNow — текущее время UTC в формате, который сравнивается как строка
+// и читается драйвером в time.Time (с точностью до миллисекунд).
+const sqliteNow = "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+
+// sqliteUserColumns — аналог userColumns: в SQLite колонки объявлены NOT NULL,
+// а COALESCE лишил бы их типа TIMESTAMP, по которому драйвер разбирает время.
+const sqliteUserColumns = "id, name, email, status, created_at, updated_at, version, deleted_at"
+
+var (
+	pgPlaceholder = regexp.MustCompile(`\$(\d+)`)
+	pgLike        = regexp.MustCompile(`LIKE \$(\d+)`)
+)
+
+// sqliteQuery переводит общий запрос PostgreSQL на диалект SQLite: нумерованные
+// параметры ?N, время в sqliteNow, явный символ экранирования LIKE (в
+// PostgreSQL это '\' по умолчанию). Блокировки строк FOR UPDATE не нужны:
+// SQLiteStore выполняет все запросы на единственном соединении.
+func sqliteQuery(query string) string {
+	query = strings.ReplaceAll(query, userColumns, sqliteUserColumns)
+	query = strings.ReplaceAll(query, "CURRENT_TIMESTAMP", sqliteNow)
+	query = strings.ReplaceAll(query, " FOR UPDATE", "")
+	query = pgLike.ReplaceAllString(query, `LIKE ?${1} ESCAPE '\'`)
+	return pgPlaceholder.ReplaceAllString(query, "?${1}")
+}
+
+var (
+	sqliteInsertUserSQL      = sqliteQuery(insertUserSQL)
+	sqliteSelectUserSQL      = sqliteQuery(selectUserSQL)
+	sqliteUpdateUserSQL      = sqliteQuery(updateUserSQL)
+	sqliteSoftDeleteUserSQL  = sqliteQuery(softDeleteUserSQL)
+	sqliteRestoreUserSQL     = sqliteQuery(restoreUserSQL)
+	sqliteUserExistsSQL      = sqliteQuery(userExistsSQL)
+	sqliteInsertUserEventSQL = sqliteQuery(insertUserEventSQL)
+
+	sqlitePurgeUsersSQL = "DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < strftime('%Y-%m-%d %H:%M:%f', 'now', ?1) RETURNING " + sqliteUserColumns
+)
+
+var registerSQLiteFuncs sync.Once
+
+// OpenSQLite открывает базу SQLite по адресу sqlite://... и применяет
+// встроенные миграции схемы.
+func OpenSQLite(ctx context.Context, url string) (*sql.DB, error) {
+	path := strings.TrimPrefix(url, SQLiteScheme)
+	if path == "" {
+		return nil, fmt.Errorf("SQLite database path is empty in %q", url)
+	}
+
+	// lower() в SQLite понимает только ASCII; приводим его к поведению
+	// PostgreSQL, чтобы фильтры по префиксу совпадали для любых имен
+	var regErr error
+	registerSQLiteFuncs.Do(func() {
+		regErr = sqlite.RegisterDeterministicScalarFunction("lower", 1,
+			func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+				if s, ok := args[0].(string); ok {
+					return strings.ToLower(s), nil
+				}
+				return args[0], nil
+			})
+	})
+	if regErr != nil {
+		return nil, fmt.Errorf("failed to register SQLite functions: %w", regErr)
+	}
+
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	// SQLite допускает одного писателя. Единственное соединение сериализует
+	// транзакции (это заменяет блокировки строк) и сохраняет базу :memory:,
+	// которая существует, пока открыто соединение
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	if err := migrateSQLite(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// migrateSQLite применяет встроенные миграции, номер которых больше
+// PRAGMA user_version, и обновляет его.
+func migrateSQLite(ctx context.Context, db *sql.DB) error {
+	var current int
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&current); err != nil {
+		return fmt.Errorf("failed to read SQLite schema version: %w", err)
+	}
+
+	files, err := fs.Glob(sqliteMigrations, "sqlite_migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		name := strings.TrimPrefix(file, "sqlite_migrations/")
+		version, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("invalid SQLite migration name %s", name)
+		}
+		if version <= current {
+			continue
+		}
+
+		script, err := sqliteMigrations.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to apply SQLite migration %s: %w", name, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Printf("Applied SQLite migration %s", name)
+	}
+	return nil
+}
+
+// SQLiteStore реализует интерфейс UserStore поверх SQLite для установок
+// на одном узле. Поведение API совпадает с PostgresStore, кроме событий
+// outbox: они не формируются, так как ретранслятор работает с PostgreSQL.
+type SQLiteStore struct {
+	DB *sql.DB
+}
+
+// NewSQLiteStore создает новый экземпляр SQLiteStore для базы из OpenSQLite.
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{DB: db}
+}
+
+// ListUsers возвращает страницу пользователей с учетом фильтров и сортировки.
+func (s *SQLiteStore) ListUsers(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	opts = opts.Normalize()
+	log.Printf("Listing users: %+v", opts)
+
+	query, args, err := buildListQuery(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.QueryContext(ctx, sqliteQuery(query), args...)
+	if err != nil {
+		log.Printf("Error querying users: %v", err)
+		return nil, translateError(err)
+	}
+	users, err := collectSQLUsers(rows, opts.Limit+1)
+	if err != nil {
+		log.Printf("Error reading user rows: %v", err)
+		return nil, err
+	}
+
+	page := newUserPage(users, opts)
+	log.Printf("Successfully fetched %d users", len(page.Users))
+	return page, nil
+}
+
+// CreateUser создает нового пользователя в БД.
+func (s *SQLiteStore) CreateUser(ctx context.Context, user *User) error {
+	log.Printf("Creating user: %s (%s)", user.Name, user.Email)
+
+	// Устанавливаем статус по умолчанию, если не указан
+	if user.Status == "" {
+		user.Status = StatusActive
+	}
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		created, err := scanUser(tx.QueryRowContext(ctx, sqliteInsertUserSQL, user.Name, user.Email, user.Status))
+		if err != nil {
+			return translateError(err)
+		}
+		*user = created
+		return recordSQLiteEvent(ctx, tx, user.ID, OpCreate, nil, user)
+	})
+	if err != nil {
+		log.Printf("Error creating user: %v", err)
+		return err
+	}
+	log.Printf("User created with ID: %d", user.ID)
+	return nil
+}
+
+// GetUser находит одного пользователя по ID.
+func (s *SQLiteStore) GetUser(ctx context.Context, id int) (*User, error) {
+	log.Printf("Fetching user with ID: %d", id)
+	u, err := scanUser(s.DB.QueryRowContext(ctx, sqliteSelectUserSQL, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("User with ID %d not found", id)
+			return nil, errUserNotFound(id)
+		}
+		log.Printf("Error fetching user %d: %v", id, err)
+		return nil, translateError(err)
+	}
+	return &u, nil
+}
+
+// UpdateUser обновляет данные пользователя по ID.
+func (s *SQLiteStore) UpdateUser(ctx context.Context, id int, user *User) error {
+	log.Printf("Updating user %d: %s (%s)", id, user.Name, user.Email)
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockSQLiteUser(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(before, user.Version); err != nil {
+			return err
+		}
+
+		status := user.Status
+		if status == "" {
+			status = before.Status
+		}
+
+		updated, err := scanUser(tx.QueryRowContext(ctx, sqliteUpdateUserSQL, user.Name, user.Email, status, id))
+		if err != nil {
+			return translateError(err)
+		}
+		*user = updated
+		return recordSQLiteEvent(ctx, tx, id, OpUpdate, before, user)
+	})
+	if err != nil {
+		log.Printf("Error updating user %d: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// PatchUser обновляет только переданные в патче поля пользователя
+// и возвращает его актуальное состояние.
+func (s *SQLiteStore) PatchUser(ctx context.Context, id int, patch UserPatch) (*User, error) {
+	if patch.IsEmpty() {
+		u, err := s.GetUser(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return u, checkVersion(u, patch.Version)
+	}
+	log.Printf("Patching user %d", id)
+
+	query, args := buildPatchQuery(id, patch)
+	query = sqliteQuery(query)
+
+	var patched User
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockSQLiteUser(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(before, patch.Version); err != nil {
+			return err
+		}
+
+		patched, err = scanUser(tx.QueryRowContext(ctx, query, args...))
+		if err != nil {
+			return translateError(err)
+		}
+		return recordSQLiteEvent(ctx, tx, id, OpUpdate, before, &patched)
+	})
+	if err != nil {
+		log.Printf("Error patching user %d: %v", id, err)
+		return nil, err
+	}
+	return &patched, nil
+}
+
+// DeleteUser мягко удаляет пользователя по ID.
+func (s *SQLiteStore) DeleteUser(ctx context.Context, id int, version int) error {
+	log.Printf("Deleting user with ID: %d", id)
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockSQLiteUser(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(before, version); err != nil {
+			return err
+		}
+
+		deleted, err := scanUser(tx.QueryRowContext(ctx, sqliteSoftDeleteUserSQL, id))
+		if err != nil {
+			return translateError(err)
+		}
+		return recordSQLiteEvent(ctx, tx, id, OpDelete, before, &deleted)
+	})
+	if err != nil {
+		log.Printf("Error deleting user %d: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// RestoreUser восстанавливает мягко удаленного пользователя.
+func (s *SQLiteStore) RestoreUser(ctx context.Context, id int) (*User, error) {
+	log.Printf("Restoring user with ID: %d", id)
+	var restored User
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockSQLiteUser(ctx, tx, id, true)
+		if err != nil {
+			return err
+		}
+
+		restored, err = scanUser(tx.QueryRowContext(ctx, sqliteRestoreUserSQL, id))
+		if err != nil {
+			return translateError(err)
+		}
+		return recordSQLiteEvent(ctx, tx, id, OpRestore, before, &restored)
+	})
+	if err != nil {
+		log.Printf("Error restoring user %d: %v", id, err)
+		return nil, err
+	}
+	return &restored, nil
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, мягко удаленных
+// раньше, чем retention назад.
+func (s *SQLiteStore) PurgeDeletedUsers(ctx context.Context, retention time.Duration) ([]int, error) {
+	log.Printf("Purging users deleted more than %v ago", retention)
+	var ids []int
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, sqlitePurgeUsersSQL, fmt.Sprintf("-%f seconds", retention.Seconds()))
+		if err != nil {
+			return translateError(err)
+		}
+		purged, err := collectSQLUsers(rows, 0)
+		if err != nil {
+			return err
+		}
+
+		for i := range purged {
+			if err := recordSQLiteEvent(ctx, tx, purged[i].ID, OpPurge, &purged[i], nil); err != nil {
+				return err
+			}
+			ids = append(ids, purged[i].ID)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error purging deleted users: %v", err)
+		return nil, err
+	}
+	log.Printf("Successfully purged %d users", len(ids))
+	return ids, nil
+}
+
+// GetUserHistory возвращает историю изменений пользователя от новых событий
+// к старым. История доступна и для удаленных пользователей.
+func (s *SQLiteStore) GetUserHistory(ctx context.Context, id int, opts HistoryOptions) (*EventPage, error) {
+	opts = opts.Normalize()
+	log.Printf("Fetching history of user %d", id)
+
+	query, args, err := buildHistoryQuery(id, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.QueryContext(ctx, sqliteQuery(query), args...)
+	if err != nil {
+		log.Printf("Error querying history of user %d: %v", id, err)
+		return nil, translateError(err)
+	}
+	events := make([]UserEvent, 0, opts.Limit+1)
+	for rows.Next() {
+		var (
+			e             UserEvent
+			before, after []byte
+		)
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Actor, &e.Operation, &before, &after, &e.CreatedAt); err != nil {
+			rows.Close()
+			return nil, translateError(err)
+		}
+		e.Before, e.After = before, after
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+
+	if len(events) == 0 && opts.Cursor == "" {
+		var exists bool
+		if err := s.DB.QueryRowContext(ctx, sqliteUserExistsSQL, id).Scan(&exists); err != nil {
+			return nil, translateError(err)
+		}
+		if !exists {
+			return nil, errUserNotFound(id)
+		}
+	}
+
+	return newEventPage(events, opts), nil
+}
+
+// withTx выполняет fn в транзакции и фиксирует ее, если fn не вернула ошибку.
+func (s *SQLiteStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return translateError(err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return translateError(tx.Commit())
+}
+
+// recordSQLiteEvent записывает событие истории в транзакции изменения.
+func recordSQLiteEvent(ctx context.Context, tx *sql.Tx, userID int, op string, before, after *User) error {
+	diffBefore, diffAfter := userDiff(before, after)
+	_, err := tx.ExecContext(ctx, sqliteInsertUserEventSQL,
+		userID, ActorFromContext(ctx), op, nullJSON(diffBefore), nullJSON(diffAfter))
+	return translateError(err)
+}
+
+// lockSQLiteUser читает пользователя в транзакции изменения.
+// deleted выбирает мягко удаленных пользователей вместо активных.
+func lockSQLiteUser(ctx context.Context, tx *sql.Tx, id int, deleted bool) (*User, error) {
+	u, err := scanUser(tx.QueryRowContext(ctx, sqliteQuery(lockUserSQL(deleted)), id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, lockedUserNotFound(id, deleted)
+		}
+		return nil, translateError(err)
+	}
+	return &u, nil
+}
+
+// collectSQLUsers читает все строки, выбранные по userColumns, и закрывает rows.
+func collectSQLUsers(rows *sql.Rows, capacity int) ([]User, error) {
+	defer rows.Close()
+
+	users := make([]User, 0, capacity)
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, translateError(err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+	return users, nil
+}
+
+// sqliteErrorClass переводит код ошибки SQLite в ошибку хранилища.
+func sqliteErrorClass(err error) (error, bool) {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return nil, false
+	}
+	switch code := sqliteErr.Code(); {
+	case code == sqlite3.SQLITE_CONSTRAINT_UNIQUE,
+		code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return ErrConflict, true
+	case code == sqlite3.SQLITE_CONSTRAINT_NOTNULL,
+		code == sqlite3.SQLITE_CONSTRAINT_CHECK:
+		return ErrValidation, true
+	case code&0xff == sqlite3.SQLITE_BUSY,
+		code&0xff == sqlite3.SQLITE_LOCKED:
+		return ErrUnavailable, true
+	}
+	return nil, true
+}
@@ -0,0 +1,22 @@
+package storage_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/avetis74/12_app_factors/storage/storagetest"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	storagetest.TestUserStore(t, func(t *testing.T) storage.UserStore {
+		url := storage.SQLiteScheme + filepath.Join(t.TempDir(), "users.db")
+		db, err := storage.OpenSQLite(context.Background(), url)
+		if err != nil {
+			t.Fatalf("OpenSQLite(%s): %v", url, err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return storage.NewSQLiteStore(db)
+	})
+}
@@ -0,0 +1,41 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+
+	"github.com/avetis74/12_app_factors/storage"
+)
+
+// BatchStore реализует storage.BatchUserStore поверх хранилища без пакетных
+// операций, выполняя по одному запросу на пользователя. BulkCreateUsers не
+// атомарен и годится только для тестов.
+type BatchStore struct {
+	storage.UserStore
+}
+
+// GetUsersByIDs реализует storage.BatchUserStore.
+func (s BatchStore) GetUsersByIDs(ctx context.Context, ids []int) ([]storage.User, error) {
+	users := make([]storage.User, 0, len(ids))
+	for _, id := range ids {
+		u, err := s.GetUser(ctx, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, nil
+}
+
+// BulkCreateUsers реализует storage.BatchUserStore.
+func (s BatchStore) BulkCreateUsers(ctx context.Context, users []*storage.User) error {
+	for _, u := range users {
+		if err := s.CreateUser(ctx, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
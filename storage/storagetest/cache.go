@@ -0,0 +1,269 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/avetis74/12_app_factors/storage"
+)
+
+// CacheFactory создает кеш для одного подтеста.
+type CacheFactory func(t *testing.T) storage.CacheService
+
+// cacheTTL — срок жизни ключей в проверке истечения. Достаточно велик,
+// чтобы запись успела прочитаться до истечения даже на медленном Redis.
+const cacheTTL = 200 * time.Millisecond
+
+// TestCacheService проверяет реализацию storage.CacheService.
+// Все ключи создаются с уникальным префиксом, поэтому кеш может быть общим.
+func TestCacheService(t *testing.T, newCache CacheFactory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, c storage.CacheService, prefix string)
+	}{
+		{"SetGet", testSetGet},
+		{"Miss", testMiss},
+		{"Overwrite", testOverwrite},
+		{"Delete", testDelete},
+		{"TTL", testTTL},
+		{"DeletePattern", testDeletePattern},
+		{"DeletePatternGlob", testDeletePatternGlob},
+		{"Concurrent", testCacheConcurrent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix := fmt.Sprintf("storagetest:%d:%d:", time.Now().UnixNano(), runSeq.Add(1))
+			tt.fn(t, newCache(t), prefix)
+		})
+	}
+}
+
+// cachedValue — составное значение для проверки сериализации.
+type cachedValue struct {
+	Name  string            `json:"name"`
+	Count int               `json:"count"`
+	Tags  []string          `json:"tags"`
+	Attrs map[string]string `json:"attrs"`
+}
+
+func set(t *testing.T, c storage.CacheService, key string, value interface{}, ttl time.Duration) {
+	t.Helper()
+	if err := c.Set(context.Background(), key, value, ttl); err != nil {
+		t.Fatalf("Set(%q): %v", key, err)
+	}
+}
+
+func expectHit(t *testing.T, c storage.CacheService, key string) {
+	t.Helper()
+	var v interface{}
+	if err := c.Get(context.Background(), key, &v); err != nil {
+		t.Fatalf("Get(%q): expected a hit, got %v", key, err)
+	}
+}
+
+func expectMiss(t *testing.T, c storage.CacheService, key string) {
+	t.Helper()
+	var v interface{}
+	if err := c.Get(context.Background(), key, &v); !errors.Is(err, storage.ErrCacheMiss) {
+		t.Fatalf("Get(%q): expected ErrCacheMiss, got %v (value %v)", key, err, v)
+	}
+}
+
+func testSetGet(t *testing.T, c storage.CacheService, prefix string) {
+	want := cachedValue{Name: "alice", Count: 3, Tags: []string{"a", "b"}, Attrs: map[string]string{"k": "v"}}
+	set(t, c, prefix+"value", want, time.Minute)
+
+	var got cachedValue
+	if err := c.Get(context.Background(), prefix+"value", &got); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Get = %+v, want %+v", got, want)
+	}
+
+	// Кеш хранит копию: изменение исходного значения не влияет на кеш
+	want.Tags[0] = "changed"
+	var again cachedValue
+	if err := c.Get(context.Background(), prefix+"value", &again); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if again.Tags[0] != "a" {
+		t.Fatalf("cached value shares memory with the stored value: %+v", again)
+	}
+
+	var user storage.User
+	deletedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	set(t, c, prefix+"user", storage.User{ID: 7, Name: "Bob", Email: "bob@example.com", Version: 2, DeletedAt: &deletedAt}, time.Minute)
+	if err := c.Get(context.Background(), prefix+"user", &user); err != nil {
+		t.Fatalf("Get(user): %v", err)
+	}
+	if user.ID != 7 || user.Name != "Bob" || user.Version != 2 || user.DeletedAt == nil || !user.DeletedAt.Equal(deletedAt) {
+		t.Fatalf("Get(user) = %+v", user)
+	}
+}
+
+func testMiss(t *testing.T, c storage.CacheService, prefix string) {
+	expectMiss(t, c, prefix+"missing")
+}
+
+func testOverwrite(t *testing.T, c storage.CacheService, prefix string) {
+	set(t, c, prefix+"key", "first", time.Minute)
+	set(t, c, prefix+"key", "second", time.Minute)
+
+	var got string
+	if err := c.Get(context.Background(), prefix+"key", &got); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got != "second" {
+		t.Fatalf("Get after overwrite = %q, want %q", got, "second")
+	}
+}
+
+func testDelete(t *testing.T, c storage.CacheService, prefix string) {
+	ctx := context.Background()
+	set(t, c, prefix+"a", 1, time.Minute)
+	set(t, c, prefix+"b", 2, time.Minute)
+
+	if err := c.Delete(ctx, prefix+"a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	expectMiss(t, c, prefix+"a")
+	expectHit(t, c, prefix+"b")
+
+	if err := c.Delete(ctx, prefix+"missing"); err != nil {
+		t.Fatalf("Delete of missing key: %v", err)
+	}
+}
+
+func testTTL(t *testing.T, c storage.CacheService, prefix string) {
+	set(t, c, prefix+"short", "v", cacheTTL)
+	set(t, c, prefix+"long", "v", time.Minute)
+	set(t, c, prefix+"forever", "v", 0)
+	expectHit(t, c, prefix+"short")
+
+	time.Sleep(cacheTTL + 100*time.Millisecond)
+	expectMiss(t, c, prefix+"short")
+	expectHit(t, c, prefix+"long")
+	expectHit(t, c, prefix+"forever")
+
+	// Перезапись продлевает срок жизни
+	set(t, c, prefix+"renewed", "v", cacheTTL)
+	time.Sleep(cacheTTL / 2)
+	set(t, c, prefix+"renewed", "v", cacheTTL)
+	time.Sleep(cacheTTL / 2)
+	expectHit(t, c, prefix+"renewed")
+
+	if err := c.Delete(context.Background(), prefix+"forever"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+}
+
+func testDeletePattern(t *testing.T, c storage.CacheService, prefix string) {
+	ctx := context.Background()
+	for _, key := range []string{"user:1", "user:2", "users:list:a", "users:list:b", "other"} {
+		set(t, c, prefix+key, key, time.Minute)
+	}
+
+	if err := c.DeletePattern(ctx, prefix+"users:list:*"); err != nil {
+		t.Fatalf("DeletePattern: %v", err)
+	}
+	expectMiss(t, c, prefix+"users:list:a")
+	expectMiss(t, c, prefix+"users:list:b")
+	expectHit(t, c, prefix+"user:1")
+	expectHit(t, c, prefix+"user:2")
+	expectHit(t, c, prefix+"other")
+
+	// "user:*" не должен задевать "users:..."
+	set(t, c, prefix+"users:list:c", "c", time.Minute)
+	if err := c.DeletePattern(ctx, prefix+"user:*"); err != nil {
+		t.Fatalf("DeletePattern: %v", err)
+	}
+	expectMiss(t, c, prefix+"user:1")
+	expectMiss(t, c, prefix+"user:2")
+	expectHit(t, c, prefix+"users:list:c")
+
+	if err := c.DeletePattern(ctx, prefix+"nothing:*"); err != nil {
+		t.Fatalf("DeletePattern without matches: %v", err)
+	}
+
+	if err := c.DeletePattern(ctx, prefix+"*"); err != nil {
+		t.Fatalf("DeletePattern: %v", err)
+	}
+	expectMiss(t, c, prefix+"users:list:c")
+	expectMiss(t, c, prefix+"other")
+}
+
+func testDeletePatternGlob(t *testing.T, c storage.CacheService, prefix string) {
+	ctx := context.Background()
+	for _, key := range []string{"hallo", "hello", "hxllo", "heello", "h*llo"} {
+		set(t, c, prefix+key, key, time.Minute)
+	}
+
+	if err := c.DeletePattern(ctx, prefix+"h[ae]llo"); err != nil {
+		t.Fatalf("DeletePattern: %v", err)
+	}
+	expectMiss(t, c, prefix+"hallo")
+	expectMiss(t, c, prefix+"hello")
+	expectHit(t, c, prefix+"hxllo")
+
+	if err := c.DeletePattern(ctx, prefix+`h\*llo`); err != nil {
+		t.Fatalf("DeletePattern: %v", err)
+	}
+	expectMiss(t, c, prefix+"h*llo")
+	expectHit(t, c, prefix+"hxllo")
+
+	if err := c.DeletePattern(ctx, prefix+"h?llo"); err != nil {
+		t.Fatalf("DeletePattern: %v", err)
+	}
+	expectMiss(t, c, prefix+"hxllo")
+	expectHit(t, c, prefix+"heello")
+
+	if err := c.DeletePattern(ctx, prefix+"*"); err != nil {
+		t.Fatalf("DeletePattern: %v", err)
+	}
+}
+
+func testCacheConcurrent(t *testing.T, c storage.CacheService, prefix string) {
+	const workers = 16
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*3)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("%sworker:%d", prefix, i)
+			for j := 0; j < 20; j++ {
+				if err := c.Set(ctx, key, j, time.Minute); err != nil {
+					errs <- err
+					return
+				}
+				var got int
+				if err := c.Get(ctx, key, &got); err != nil {
+					errs <- fmt.Errorf("Get(%q) after Set: %w", key, err)
+					return
+				}
+				if got != j {
+					errs <- fmt.Errorf("Get(%q) = %d, want %d", key, got, j)
+					return
+				}
+			}
+			if err := c.DeletePattern(ctx, prefix+"shared:*"); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if err := c.DeletePattern(ctx, prefix+"*"); err != nil {
+		t.Fatalf("DeletePattern: %v", err)
+	}
+}
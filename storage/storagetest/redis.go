@@ -0,0 +1,32 @@
+package storagetest
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/avetis74/12_app_factors/storage"
+)
+
+// DegradedCache создает ReconnectingCache для Redis, соединения с которым
+// отклоняются (порт только что освобожден), и проверяет его, переводя
+// в состояние degraded. Кеш закрывается по завершении теста.
+func DegradedCache(t *testing.T) *storage.ReconnectingCache {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	cache, err := storage.NewReconnectingCache("redis://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	if err := cache.Check(context.Background()); err == nil {
+		t.Fatal("Check succeeded against unreachable Redis")
+	}
+	return cache
+}
@@ -0,0 +1,648 @@
+// Package storagetest содержит общие наборы тестов, которые проверяют,
+// что реализации storage.UserStore и storage.CacheService соблюдают контракт
+// интерфейсов. Каждая реализация подключает их в своих тестах:
+//
+//	func TestMemoryStore(t *testing.T) {
+//		storagetest.TestUserStore(t, func(t *testing.T) storage.UserStore {
+//			return storage.NewMemoryStore()
+//		})
+//	}
+//
+// Наборы не требуют пустого хранилища: все данные создаются с уникальными
+// email и ключами, поэтому их можно запускать против общей тестовой БД.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/avetis74/12_app_factors/storage"
+)
+
+// UserStoreFactory создает хранилище для одного подтеста.
+type UserStoreFactory func(t *testing.T) storage.UserStore
+
+// missingUserID — ID, которого заведомо нет в хранилище.
+const missingUserID = 1 << 30
+
+// TestUserStore проверяет реализацию storage.UserStore.
+// PurgeDeletedUsers вызывается с нулевым сроком хранения и окончательно
+// удаляет всех мягко удаленных пользователей хранилища.
+func TestUserStore(t *testing.T, newStore UserStoreFactory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.UserStore, u *uniq)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"DefaultStatus", testDefaultStatus},
+		{"GetNotFound", testGetNotFound},
+		{"DuplicateEmail", testDuplicateEmail},
+		{"Update", testUpdate},
+		{"UpdateKeepsStatus", testUpdateKeepsStatus},
+		{"UpdateNotFound", testUpdateNotFound},
+		{"Patch", testPatch},
+		{"VersionMismatch", testVersionMismatch},
+		{"DeleteAndRestore", testDeleteAndRestore},
+		{"Purge", testPurge},
+		{"List", testList},
+		{"ListInvalidCursor", testListInvalidCursor},
+		{"History", testHistory},
+		{"ConcurrentCreate", testConcurrentCreate},
+		{"ConcurrentDuplicateEmail", testConcurrentDuplicateEmail},
+		{"ConcurrentUpdate", testConcurrentUpdate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t), newUniq())
+		})
+	}
+}
+
+// uniq выдает уникальные в пределах запуска email, чтобы наборы не мешали
+// друг другу и существующим данным.
+type uniq struct {
+	prefix string
+	n      atomic.Int64
+}
+
+var runSeq atomic.Int64
+
+func newUniq() *uniq {
+	return &uniq{prefix: fmt.Sprintf("st%d-%d-", time.Now().UnixNano(), runSeq.Add(1))}
+}
+
+func (u *uniq) email() string {
+	return fmt.Sprintf("%s%d@example.com", u.prefix, u.n.Add(1))
+}
+
+func (u *uniq) user(name string) *storage.User {
+	return &storage.User{Name: name, Email: u.email()}
+}
+
+func create(t *testing.T, s storage.UserStore, user *storage.User) *storage.User {
+	t.Helper()
+	if err := s.CreateUser(context.Background(), user); err != nil {
+		t.Fatalf("CreateUser(%q): %v", user.Email, err)
+	}
+	return user
+}
+
+func expectErr(t *testing.T, op string, err, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("%s: got error %v, want %v", op, err, target)
+	}
+}
+
+func sameUser(t *testing.T, got, want *storage.User) {
+	t.Helper()
+	if got.ID != want.ID || got.Name != want.Name || got.Email != want.Email ||
+		got.Status != want.Status || got.Version != want.Version {
+		t.Fatalf("got user %+v, want %+v", got, want)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || !got.UpdatedAt.Equal(want.UpdatedAt) {
+		t.Fatalf("got timestamps %v/%v, want %v/%v", got.CreatedAt, got.UpdatedAt, want.CreatedAt, want.UpdatedAt)
+	}
+	if (got.DeletedAt == nil) != (want.DeletedAt == nil) {
+		t.Fatalf("got deleted_at %v, want %v", got.DeletedAt, want.DeletedAt)
+	}
+}
+
+func testCreateAndGet(t *testing.T, s storage.UserStore, u *uniq) {
+	ctx := context.Background()
+	user := create(t, s, &storage.User{Name: "Alice", Email: u.email(), Status: storage.StatusInactive})
+
+	if user.ID <= 0 {
+		t.Fatalf("CreateUser: got ID %d, want positive", user.ID)
+	}
+	if user.Status != storage.StatusInactive {
+		t.Fatalf("CreateUser: got status %q, want %q", user.Status, storage.StatusInactive)
+	}
+	if user.Version < 1 {
+		t.Fatalf("CreateUser: got version %d, want at least 1", user.Version)
+	}
+	if user.CreatedAt.IsZero() || user.UpdatedAt.IsZero() {
+		t.Fatalf("CreateUser: timestamps are not set: %+v", user)
+	}
+	if user.DeletedAt != nil {
+		t.Fatalf("CreateUser: new user is deleted: %+v", user)
+	}
+
+	got, err := s.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUser(%d): %v", user.ID, err)
+	}
+	sameUser(t, got, user)
+
+	other := create(t, s, u.user("Bob"))
+	if other.ID == user.ID {
+		t.Fatalf("CreateUser: IDs are not unique: %d", other.ID)
+	}
+}
+
+func testDefaultStatus(t *testing.T, s storage.UserStore, u *uniq) {
+	user := create(t, s, u.user("Alice"))
+	if user.Status != storage.StatusActive {
+		t.Fatalf("CreateUser without status: got %q, want %q", user.Status, storage.StatusActive)
+	}
+	got, err := s.GetUser(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("GetUser(%d): %v", user.ID, err)
+	}
+	if got.Status != storage.StatusActive {
+		t.Fatalf("GetUser: got status %q, want %q", got.Status, storage.StatusActive)
+	}
+}
+
+func testGetNotFound(t *testing.T, s storage.UserStore, u *uniq) {
+	_, err := s.GetUser(context.Background(), missingUserID)
+	expectErr(t, "GetUser of missing user", err, storage.ErrNotFound)
+}
+
+func testDuplicateEmail(t *testing.T, s storage.UserStore, u *uniq) {
+	ctx := context.Background()
+	first := create(t, s, u.user("Alice"))
+
+	err := s.CreateUser(ctx, &storage.User{Name: "Alice 2", Email: first.Email})
+	expectErr(t, "CreateUser with duplicate email", err, storage.ErrConflict)
+
+	second := create(t, s, u.user("Bob"))
+	err = s.UpdateUser(ctx, second.ID, &storage.User{Name: "Bob", Email: first.Email})
+	expectErr(t, "UpdateUser to duplicate email", err, storage.ErrConflict)
+
+	email := first.Email
+	_, err = s.PatchUser(ctx, second.ID, storage.UserPatch{Email: &email})
+	expectErr(t, "PatchUser to duplicate email", err, storage.ErrConflict)
+
+	// После мягкого удаления email можно использовать повторно,
+	// но тогда удаленного пользователя нельзя восстановить
+	if err := s.DeleteUser(ctx, first.ID, 0); err != nil {
+		t.Fatalf("DeleteUser(%d): %v", first.ID, err)
+	}
+	create(t, s, &storage.User{Name: "Alice 3", Email: first.Email})
+	_, err = s.RestoreUser(ctx, first.ID)
+	expectErr(t, "RestoreUser with taken email", err, storage.ErrConflict)
+}
+
+func testUpdate(t *testing.T, s storage.UserStore, u *uniq) {
+	ctx := context.Background()
+	user := create(t, s, u.user("Alice"))
+
+	update := &storage.User{Name: "Alice Updated", Email: u.email(), Status: storage.StatusSuspended}
+	if err := s.UpdateUser(ctx, user.ID, update); err != nil {
+		t.Fatalf("UpdateUser(%d): %v", user.ID, err)
+	}
+	if update.ID != user.ID || update.Name != "Alice Updated" || update.Status != storage.StatusSuspended {
+		t.Fatalf("UpdateUser: got %+v", update)
+	}
+	if update.Version != user.Version+1 {
+		t.Fatalf("UpdateUser: got version %d, want %d", update.Version, user.Version+1)
+	}
+	if !update.CreatedAt.Equal(user.CreatedAt) {
+		t.Fatalf("UpdateUser changed created_at: %v -> %v", user.CreatedAt, update.CreatedAt)
+	}
+
+	got, err := s.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUser(%d): %v", user.ID, err)
+	}
+	sameUser(t, got, update)
+}
+
+func testUpdateKeepsStatus(t *testing.T, s storage.UserStore, u *uniq) {
+	user := create(t, s, &storage.User{Name: "Alice", Email: u.email(), Status: storage.StatusSuspended})
+
+	update := &storage.User{Name: "Alice", Email: user.Email}
+	if err := s.UpdateUser(context.Background(), user.ID, update); err != nil {
+		t.Fatalf("UpdateUser(%d): %v", user.ID, err)
+	}
+	if update.Status != storage.StatusSuspended {
+		t.Fatalf("UpdateUser without status: got %q, want %q", update.Status, storage.StatusSuspended)
+	}
+}
+
+func testUpdateNotFound(t *testing.T, s storage.UserStore, u *uniq) {
+	ctx := context.Background()
+	err := s.UpdateUser(ctx, missingUserID, u.user("Nobody"))
+	expectErr(t, "UpdateUser of missing user", err, storage.ErrNotFound)
+
+	name := "Nobody"
+	_, err = s.PatchUser(ctx, missingUserID, storage.UserPatch{Name: &name})
+	expectErr(t, "PatchUser of missing user", err, storage.ErrNotFound)
+
+	_, err = s.PatchUser(ctx, missingUserID, storage.UserPatch{})
+	expectErr(t, "empty PatchUser of missing user", err, storage.ErrNotFound)
+
+	err = s.DeleteUser(ctx, missingUserID, 0)
+	expectErr(t, "DeleteUser of missing user", err, storage.ErrNotFound)
+
+	_, err = s.RestoreUser(ctx, missingUserID)
+	expectErr(t, "RestoreUser of missing user", err, storage.ErrNotFound)
+}
+
+func testPatch(t *testing.T, s storage.UserStore, u *uniq) {
+	ctx := context.Background()
+	user := create(t, s, u.user("Alice"))
+
+	status := storage.StatusInactive
+	patched, err := s.PatchUser(ctx, user.ID, storage.UserPatch{Status: &status})
+	if err != nil {
+		t.Fatalf("PatchUser(%d): %v", user.ID, err)
+	}
+	if patched.Status != status || patched.Name != user.Name || patched.Email != user.Email {
+		t.Fatalf("PatchUser changed other fields: %+v -> %+v", user, patched)
+	}
+	if patched.Version != user.Version+1 {
+		t.Fatalf("PatchUser: got version %d, want %d", patched.Version, user.Version+1)
+	}
+
+	// Пустой патч ничего не меняет и возвращает текущее состояние
+	same, err := s.PatchUser(ctx, user.ID, storage.UserPatch{})
+	if err != nil {
+		t.Fatalf("empty PatchUser(%d): %v", user.ID, err)
+	}
+	sameUser(t, same, patched)
+}
+
+func testVersionMismatch(t *testing.T, s storage.UserStore, u *uniq) {
+	ctx := context.Background()
+	user := create(t, s, u.user("Alice"))
+	stale := user.Version + 100
+
+	err := s.UpdateUser(ctx, user.ID, &storage.User{Name: "Alice", Email: user.Email, Version: stale})
+	expectErr(t, "UpdateUser with stale version", err, storage.ErrPreconditionFailed)
+
+	name := "Alice"
+	_, err = s.PatchUser(ctx, user.ID, storage.UserPatch{Name: &name, Version: stale})
+	expectErr(t, "PatchUser with stale version", err, storage.ErrPreconditionFailed)
+
+	_, err = s.PatchUser(ctx, user.ID, storage.UserPatch{Version: stale})
+	expectErr(t, "empty PatchUser with stale version", err, storage.ErrPreconditionFailed)
+
+	err = s.DeleteUser(ctx, user.ID, stale)
+	expectErr(t, "DeleteUser with stale version", err, storage.ErrPreconditionFailed)
+
+	// Совпадающая версия проходит проверку
+	update := &storage.User{Name: "Alice", Email: user.Email, Version: user.Version}
+	if err := s.UpdateUser(ctx, user.ID, update); err != nil {
+		t.Fatalf("UpdateUser with current version: %v", err)
+	}
+}
+
+func testDeleteAndRestore(t *testing.T, s storage.UserStore, u *uniq) {
+	ctx := context.Background()
+	user := create(t, s, u.user("Alice"))
+
+	if err := s.DeleteUser(ctx, user.ID, user.Version); err != nil {
+		t.Fatalf("DeleteUser(%d): %v", user.ID, err)
+	}
+	_, err := s.GetUser(ctx, user.ID)
+	expectErr(t, "GetUser of deleted user", err, storage.ErrNotFound)
+	err = s.DeleteUser(ctx, user.ID, 0)
+	expectErr(t, "DeleteUser of deleted user", err, storage.ErrNotFound)
+	err = s.UpdateUser(ctx, user.ID, &storage.User{Name: "Alice", Email: user.Email})
+	expectErr(t, "UpdateUser of deleted user", err, storage.ErrNotFound)
+
+	restored, err := s.RestoreUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("RestoreUser(%d): %v", user.ID, err)
+	}
+	if restored.DeletedAt != nil {
+		t.Fatalf("RestoreUser: user is still deleted: %+v", restored)
+	}
+	if restored.Version <= user.Version {
+		t.Fatalf("RestoreUser: version did not increase: %d -> %d", user.Version, restored.Version)
+	}
+	if _, err := s.GetUser(ctx, user.ID); err != nil {
+		t.Fatalf("GetUser of restored user: %v", err)
+	}
+
+	_, err = s.RestoreUser(ctx, user.ID)
+	expectErr(t, "RestoreUser of active user", err, storage.ErrNotFound)
+}
+
+func testPurge(t *testing.T, s storage.UserStore, u *uniq) {
+	ctx := context.Background()
+	active := create(t, s, u.user("Active"))
+	deleted := create(t, s, u.user("Deleted"))
+	if err := s.DeleteUser(ctx, deleted.ID, 0); err != nil {
+		t.Fatalf("DeleteUser(%d): %v", deleted.ID, err)
+	}
+
+	// Срок хранения еще не истек
+	ids, err := s.PurgeDeletedUsers(ctx, time.Hour)
+	if err != nil {
+		t.Fatalf("PurgeDeletedUsers(1h): %v", err)
+	}
+	if containsID(ids, deleted.ID) {
+		t.Fatalf("PurgeDeletedUsers(1h) purged recently deleted user %d", deleted.ID)
+	}
+
+	// Метки времени хранилищ могут иметь точность до микросекунд
+	time.Sleep(10 * time.Millisecond)
+	ids, err = s.PurgeDeletedUsers(ctx, 0)
+	if err != nil {
+		t.Fatalf("PurgeDeletedUsers(0): %v", err)
+	}
+	if !containsID(ids, deleted.ID) {
+		t.Fatalf("PurgeDeletedUsers(0) = %v, want it to contain %d", ids, deleted.ID)
+	}
+	if containsID(ids, active.ID) {
+		t.Fatalf("PurgeDeletedUsers(0) purged active user %d", active.ID)
+	}
+
+	_, err = s.RestoreUser(ctx, deleted.ID)
+	expectErr(t, "RestoreUser of purged user", err, storage.ErrNotFound)
+	if _, err := s.GetUser(ctx, active.ID); err != nil {
+		t.Fatalf("GetUser of active user after purge: %v", err)
+	}
+}
+
+func containsID(ids []int, id int) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func testList(t *testing.T, s storage.UserStore, u *uniq) {
+	ctx := context.Background()
+	var created []*storage.User
+	for i := 0; i < 5; i++ {
+		user := &storage.User{Name: fmt.Sprintf("User %d", i), Email: u.email()}
+		if i%2 == 1 {
+			user.Status = storage.StatusSuspended
+		}
+		created = append(created, create(t, s, user))
+	}
+	if err := s.DeleteUser(ctx, created[4].ID, 0); err != nil {
+		t.Fatalf("DeleteUser(%d): %v", created[4].ID, err)
+	}
+
+	// Постраничный обход возвращает каждого пользователя ровно один раз и по порядку
+	for _, sort := range []storage.SortOrder{storage.SortByIDAsc, storage.SortByIDDesc} {
+		var ids []int
+		opts := storage.ListOptions{EmailPrefix: u.prefix, Limit: 2, Sort: sort}
+		for pages := 0; ; pages++ {
+			if pages > 10 {
+				t.Fatalf("ListUsers(%s): pagination does not terminate", sort)
+			}
+			page, err := s.ListUsers(ctx, opts)
+			if err != nil {
+				t.Fatalf("ListUsers(%s): %v", sort, err)
+			}
+			if len(page.Users) > opts.Limit {
+				t.Fatalf("ListUsers(%s): got %d users, limit %d", sort, len(page.Users), opts.Limit)
+			}
+			for _, user := range page.Users {
+				ids = append(ids, user.ID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			opts.Cursor = page.NextCursor
+		}
+
+		want := []int{created[0].ID, created[1].ID, created[2].ID, created[3].ID}
+		if sort == storage.SortByIDDesc {
+			want = []int{created[3].ID, created[2].ID, created[1].ID, created[0].ID}
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(want) {
+			t.Fatalf("ListUsers(%s) = %v, want %v", sort, ids, want)
+		}
+	}
+
+	page, err := s.ListUsers(ctx, storage.ListOptions{EmailPrefix: u.prefix, Status: storage.StatusSuspended})
+	if err != nil {
+		t.Fatalf("ListUsers(status): %v", err)
+	}
+	if got := userIDs(page.Users); fmt.Sprint(got) != fmt.Sprint([]int{created[1].ID, created[3].ID}) {
+		t.Fatalf("ListUsers(status=suspended) = %v", got)
+	}
+
+	page, err = s.ListUsers(ctx, storage.ListOptions{EmailPrefix: u.prefix, NamePrefix: "user 2"})
+	if err != nil {
+		t.Fatalf("ListUsers(name_prefix): %v", err)
+	}
+	if got := userIDs(page.Users); fmt.Sprint(got) != fmt.Sprint([]int{created[2].ID}) {
+		t.Fatalf("ListUsers(name_prefix=user 2) = %v", got)
+	}
+
+	page, err = s.ListUsers(ctx, storage.ListOptions{EmailPrefix: u.prefix, IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("ListUsers(include_deleted): %v", err)
+	}
+	if len(page.Users) != len(created) {
+		t.Fatalf("ListUsers(include_deleted) returned %d users, want %d", len(page.Users), len(created))
+	}
+
+	page, err = s.ListUsers(ctx, storage.ListOptions{EmailPrefix: u.prefix + "nobody"})
+	if err != nil {
+		t.Fatalf("ListUsers(no match): %v", err)
+	}
+	if page.Users == nil || len(page.Users) != 0 || page.NextCursor != "" {
+		t.Fatalf("ListUsers(no match) = %+v, want an empty non-nil page", page)
+	}
+}
+
+func userIDs(users []storage.User) []int {
+	ids := make([]int, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	return ids
+}
+
+func testListInvalidCursor(t *testing.T, s storage.UserStore, u *uniq) {
+	ctx := context.Background()
+	_, err := s.ListUsers(ctx, storage.ListOptions{Cursor: "not a cursor"})
+	expectErr(t, "ListUsers with malformed cursor", err, storage.ErrInvalidCursor)
+
+	// Курсор, выданный для другой сортировки, отклоняется
+	for i := 0; i < 2; i++ {
+		create(t, s, u.user("User"))
+	}
+	page, err := s.ListUsers(ctx, storage.ListOptions{EmailPrefix: u.prefix, Limit: 1})
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if page.NextCursor == "" {
+		t.Fatal("ListUsers: expected a next cursor")
+	}
+	_, err = s.ListUsers(ctx, storage.ListOptions{Cursor: page.NextCursor, Sort: storage.SortByIDDesc})
+	expectErr(t, "ListUsers with cursor of another sort order", err, storage.ErrInvalidCursor)
+}
+
+func testHistory(t *testing.T, s storage.UserStore, u *uniq) {
+	ctx := storage.WithActor(context.Background(), "storagetest")
+	user := create(t, s, u.user("Alice"))
+	status := storage.StatusInactive
+	if _, err := s.PatchUser(ctx, user.ID, storage.UserPatch{Status: &status}); err != nil {
+		t.Fatalf("PatchUser(%d): %v", user.ID, err)
+	}
+	if err := s.DeleteUser(ctx, user.ID, 0); err != nil {
+		t.Fatalf("DeleteUser(%d): %v", user.ID, err)
+	}
+
+	// История доступна и для удаленных пользователей, от новых событий к старым
+	var ops []string
+	opts := storage.HistoryOptions{Limit: 1}
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("GetUserHistory: pagination does not terminate")
+		}
+		page, err := s.GetUserHistory(ctx, user.ID, opts)
+		if err != nil {
+			t.Fatalf("GetUserHistory(%d): %v", user.ID, err)
+		}
+		for _, e := range page.Events {
+			if e.UserID != user.ID {
+				t.Fatalf("GetUserHistory(%d) returned event of user %d", user.ID, e.UserID)
+			}
+			ops = append(ops, e.Operation)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	want := []string{storage.OpDelete, storage.OpUpdate, storage.OpCreate}
+	if fmt.Sprint(ops) != fmt.Sprint(want) {
+		t.Fatalf("GetUserHistory(%d) operations = %v, want %v", user.ID, ops, want)
+	}
+
+	page, err := s.GetUserHistory(ctx, user.ID, storage.HistoryOptions{})
+	if err != nil {
+		t.Fatalf("GetUserHistory(%d): %v", user.ID, err)
+	}
+	if page.Events[0].Actor != "storagetest" {
+		t.Fatalf("GetUserHistory: got actor %q, want %q", page.Events[0].Actor, "storagetest")
+	}
+	if len(page.Events[1].After) == 0 {
+		t.Fatalf("GetUserHistory: update event has no diff: %+v", page.Events[1])
+	}
+
+	_, err = s.GetUserHistory(ctx, missingUserID, storage.HistoryOptions{})
+	expectErr(t, "GetUserHistory of missing user", err, storage.ErrNotFound)
+}
+
+func testConcurrentCreate(t *testing.T, s storage.UserStore, u *uniq) {
+	const writers = 20
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		ids  = map[int]bool{}
+		errs []error
+	)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user := u.user("Concurrent")
+			err := s.CreateUser(context.Background(), user)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			ids[user.ID] = true
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		t.Fatalf("concurrent CreateUser failed: %v", errs)
+	}
+	if len(ids) != writers {
+		t.Fatalf("concurrent CreateUser produced %d unique IDs, want %d", len(ids), writers)
+	}
+}
+
+func testConcurrentDuplicateEmail(t *testing.T, s storage.UserStore, u *uniq) {
+	const writers = 10
+	email := u.email()
+	var (
+		wg        sync.WaitGroup
+		created   atomic.Int32
+		conflicts atomic.Int32
+		otherErrs = make(chan error, writers)
+	)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.CreateUser(context.Background(), &storage.User{Name: "Duplicate", Email: email})
+			switch {
+			case err == nil:
+				created.Add(1)
+			case errors.Is(err, storage.ErrConflict):
+				conflicts.Add(1)
+			default:
+				otherErrs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(otherErrs)
+
+	for err := range otherErrs {
+		t.Errorf("concurrent CreateUser with duplicate email: unexpected error %v", err)
+	}
+	if created.Load() != 1 || conflicts.Load() != writers-1 {
+		t.Fatalf("concurrent CreateUser with duplicate email: %d created, %d conflicts; want 1 and %d",
+			created.Load(), conflicts.Load(), writers-1)
+	}
+}
+
+func testConcurrentUpdate(t *testing.T, s storage.UserStore, u *uniq) {
+	const writers = 10
+	user := create(t, s, u.user("Contended"))
+	var (
+		wg         sync.WaitGroup
+		updated    atomic.Int32
+		mismatches atomic.Int32
+		otherErrs  = make(chan error, writers)
+	)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("Writer %d", i)
+			_, err := s.PatchUser(context.Background(), user.ID, storage.UserPatch{Name: &name, Version: user.Version})
+			switch {
+			case err == nil:
+				updated.Add(1)
+			case errors.Is(err, storage.ErrPreconditionFailed):
+				mismatches.Add(1)
+			default:
+				otherErrs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(otherErrs)
+
+	for err := range otherErrs {
+		t.Errorf("concurrent PatchUser: unexpected error %v", err)
+	}
+	if updated.Load() != 1 || mismatches.Load() != writers-1 {
+		t.Fatalf("concurrent PatchUser with the same version: %d updated, %d mismatches; want 1 and %d",
+			updated.Load(), mismatches.Load(), writers-1)
+	}
+
+	got, err := s.GetUser(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("GetUser(%d): %v", user.ID, err)
+	}
+	if got.Version != user.Version+1 {
+		t.Fatalf("GetUser after concurrent PatchUser: got version %d, want %d", got.Version, user.Version+1)
+	}
+}
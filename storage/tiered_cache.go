@@ -0,0 +1,365 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CacheInvalidationChannel — канал Redis pub/sub, через который экземпляры
+// TieredCache сообщают друг другу об удаленных ключах.
+const CacheInvalidationChannel = "cache:invalidate"
+
+// invalidationMessage — сообщение об удалении ключа или ключей по шаблону.
+type invalidationMessage struct {
+	// Origin — экземпляр, отправивший сообщение; свои сообщения игнорируются.
+	Origin  string `json:"origin"`
+	Key     string `json:"key,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// TieredCache — двухуровневый CacheService: ограниченный LRU в памяти
+// процесса перед общим кешем (RedisCache). Чтение сначала идет в локальный
+// уровень, промах читается из общего кеша и сохраняется локально. Delete и
+// DeletePattern рассылаются через Redis pub/sub, и каждый экземпляр удаляет
+// свои локальные копии. Срок жизни локальной копии ограничен, поэтому
+// потерянное сообщение не оставляет устаревшее значение надолго. Копия,
+// прочитанная из общего кеша, живет весь локальный срок, даже если ключ в
+// общем кеше истекает раньше.
+type TieredCache struct {
+	remote CacheService
+	client *redis.Client
+	local  *lruCache
+	origin string
+	// Channel — канал pub/sub для сообщений об удалении ключей.
+	Channel string
+	// Codec кодирует значения; должен совпадать с кодеком общего кеша, чтобы
+	// оба уровня хранили одни и те же байты. nil — DefaultCodec.
+	Codec *Codec
+}
+
+// NewTieredCache создает двухуровневый кеш поверх remote. client используется
+// для рассылки и получения сообщений об удалении ключей; size и ttl задают
+// размер и срок жизни локального уровня.
+func NewTieredCache(remote CacheService, client *redis.Client, size int, ttl time.Duration) *TieredCache {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &TieredCache{
+		remote:  remote,
+		client:  client,
+		local:   newLRUCache(size, ttl),
+		origin:  hex.EncodeToString(id),
+		Channel: CacheInvalidationChannel,
+	}
+}
+
+// Available сообщает о доступности общего кеша. Пока он недоступен,
+// изменения не рассылаются, поэтому локальный уровень тоже не используется.
+func (t *TieredCache) Available() bool {
+	if health, ok := t.remote.(CacheHealth); ok {
+		return health.Available()
+	}
+	return true
+}
+
+// Set сохраняет значение в обоих уровнях кеша
+func (t *TieredCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	data, err := t.codec().Encode(value)
+	if err != nil {
+		return err
+	}
+	gen := t.local.generation()
+	if err := t.remote.Set(ctx, key, EncodedValue(data), expiration); err != nil {
+		return err
+	}
+	t.local.add(key, data, expiration, gen)
+	return nil
+}
+
+// Get получает значение из локального уровня, а при промахе — из общего кеша
+func (t *TieredCache) Get(ctx context.Context, key string, dest interface{}) error {
+	if !t.Available() {
+		return ErrCacheUnavailable
+	}
+
+	data, ok := t.local.get(key)
+	if !ok {
+		// Значение, прочитанное до удаления ключа, не сохраняется локально
+		gen := t.local.generation()
+		var raw EncodedValue
+		if err := t.remote.Get(ctx, key, &raw); err != nil {
+			return err
+		}
+		data = raw
+		t.local.add(key, data, 0, gen)
+	}
+
+	if err := t.codec().Decode(data, dest); err != nil {
+		return fmt.Errorf("failed to unmarshal cached data: %w", err)
+	}
+	return nil
+}
+
+// codec возвращает кодек значений.
+func (t *TieredCache) codec() *Codec {
+	if t.Codec != nil {
+		return t.Codec
+	}
+	return DefaultCodec
+}
+
+// Delete удаляет ключ из обоих уровней и из локальных уровней других экземпляров
+func (t *TieredCache) Delete(ctx context.Context, key string) error {
+	t.local.delete(key)
+	if err := t.remote.Delete(ctx, key); err != nil {
+		return err
+	}
+	t.publish(ctx, invalidationMessage{Key: key})
+	return nil
+}
+
+// DeletePattern удаляет ключи по шаблону из обоих уровней и из локальных
+// уровней других экземпляров
+func (t *TieredCache) DeletePattern(ctx context.Context, pattern string) error {
+	t.local.deletePattern(pattern)
+	if err := t.remote.DeletePattern(ctx, pattern); err != nil {
+		return err
+	}
+	t.publish(ctx, invalidationMessage{Pattern: pattern})
+	return nil
+}
+
+// InvalidateNamespace сбрасывает пространство имен в обоих уровнях и в
+// локальных уровнях других экземпляров. Если общий кеш не поддерживает
+// NamespaceInvalidator, ключи пространства удаляются по шаблону.
+func (t *TieredCache) InvalidateNamespace(ctx context.Context, namespace string) error {
+	pattern := escapePattern(namespace) + ":*"
+	invalidator, ok := t.remote.(NamespaceInvalidator)
+	if !ok {
+		return t.DeletePattern(ctx, pattern)
+	}
+
+	t.local.deletePattern(pattern)
+	if err := invalidator.InvalidateNamespace(ctx, namespace); err != nil {
+		return err
+	}
+	t.publish(ctx, invalidationMessage{Pattern: pattern})
+	return nil
+}
+
+// LocalCacheStats — состояние локального уровня TieredCache.
+type LocalCacheStats struct {
+	Size     int `json:"size"`
+	Capacity int `json:"capacity"`
+	// Evictions — ключи, вытесненные из-за размера или истекшие.
+	Evictions int64 `json:"evictions"`
+}
+
+// LocalStats возвращает состояние локального уровня.
+func (t *TieredCache) LocalStats() LocalCacheStats {
+	return t.local.stats()
+}
+
+// publish рассылает сообщение об удалении другим экземплярам.
+func (t *TieredCache) publish(ctx context.Context, msg invalidationMessage) {
+	msg.Origin = t.origin
+	data, _ := json.Marshal(msg)
+	if err := t.client.Publish(ctx, t.Channel, data).Err(); err != nil {
+		log.Printf("Failed to publish cache invalidation: %v", err)
+	}
+}
+
+// Run получает сообщения об удалении ключей, пока не будет отменен контекст.
+// Пока подписка не работает, сообщения теряются, поэтому при каждой
+// (пере)подписке локальный уровень очищается.
+func (t *TieredCache) Run(ctx context.Context) {
+	sub := t.client.Subscribe(ctx, t.Channel)
+	defer sub.Close()
+	// Receive не прерывается отменой контекста, пока ждет сообщения,
+	// поэтому подписка закрывается
+	stop := context.AfterFunc(ctx, func() { sub.Close() })
+	defer stop()
+
+	for {
+		msg, err := sub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Cache invalidation subscription error: %v", err)
+			t.local.purge()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			if m.Kind == "subscribe" {
+				log.Printf("Subscribed to %s", t.Channel)
+				t.local.purge()
+			}
+		case *redis.Message:
+			t.handle(m.Payload)
+		}
+	}
+}
+
+// handle применяет сообщение об удалении к локальному уровню.
+func (t *TieredCache) handle(payload string) {
+	var msg invalidationMessage
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		log.Printf("Ignoring malformed %s payload: %q", t.Channel, payload)
+		return
+	}
+	if msg.Origin == t.origin {
+		return
+	}
+	if msg.Key != "" {
+		t.local.delete(msg.Key)
+	}
+	if msg.Pattern != "" {
+		t.local.deletePattern(msg.Pattern)
+	}
+}
+
+// lruEntry — значение в lruCache.
+type lruEntry struct {
+	key       string
+	data      []byte
+	expiresAt time.Time
+}
+
+// lruCache — ограниченный по числу ключей кеш в памяти с вытеснением давно
+// не использованных ключей и общим сроком жизни.
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+	// gen увеличивается при каждом удалении, чтобы значение, прочитанное
+	// из общего кеша до удаления, не попало в локальный уровень после него.
+	gen       uint64
+	evictions int64
+}
+
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (l *lruCache) generation() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.gen
+}
+
+func (l *lruCache) get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		l.remove(el)
+		l.evictions++
+		return nil, false
+	}
+	l.order.MoveToFront(el)
+	return entry.data, true
+}
+
+// add сохраняет значение, если с момента gen не было удалений, иначе
+// удаляет ключ. Срок жизни ограничен ttl кеша и expiration (0 — без
+// ограничения).
+func (l *lruCache) add(key string, data []byte, expiration time.Duration, gen uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if gen != l.gen || l.size <= 0 {
+		// Значение прочитано или записано до удаления и не сохраняется.
+		// Прежняя копия ключа еще старше, поэтому тоже удаляется
+		if el, ok := l.entries[key]; ok {
+			l.remove(el)
+		}
+		return
+	}
+	ttl := l.ttl
+	if expiration > 0 && expiration < ttl {
+		ttl = expiration
+	}
+	entry := &lruEntry{key: key, data: data, expiresAt: time.Now().Add(ttl)}
+
+	if el, ok := l.entries[key]; ok {
+		el.Value = entry
+		l.order.MoveToFront(el)
+		return
+	}
+	l.entries[key] = l.order.PushFront(entry)
+	for l.order.Len() > l.size {
+		l.remove(l.order.Back())
+		l.evictions++
+	}
+}
+
+func (l *lruCache) stats() LocalCacheStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LocalCacheStats{Size: l.order.Len(), Capacity: l.size, Evictions: l.evictions}
+}
+
+func (l *lruCache) delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.gen++
+	if el, ok := l.entries[key]; ok {
+		l.remove(el)
+	}
+}
+
+func (l *lruCache) deletePattern(pattern string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.gen++
+	for key, el := range l.entries {
+		if matchPattern(pattern, key) {
+			l.remove(el)
+		}
+	}
+}
+
+func (l *lruCache) purge() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.gen++
+	l.order.Init()
+	l.entries = make(map[string]*list.Element)
+}
+
+// remove удаляет элемент. Вызывается под блокировкой.
+func (l *lruCache) remove(el *list.Element) {
+	l.order.Remove(el)
+	delete(l.entries, el.Value.(*lruEntry).key)
+}
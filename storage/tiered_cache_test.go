@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// expectLocal проверяет, что ключ есть в lruCache со значением want.
+func expectLocal(t *testing.T, l *lruCache, key, want string) {
+	t.Helper()
+	data, ok := l.get(key)
+	if !ok {
+		t.Fatalf("get(%q): missing, want %q", key, want)
+	}
+	if string(data) != want {
+		t.Fatalf("get(%q) = %q, want %q", key, data, want)
+	}
+}
+
+// expectNoLocal проверяет, что ключа нет в lruCache.
+func expectNoLocal(t *testing.T, l *lruCache, key string) {
+	t.Helper()
+	if data, ok := l.get(key); ok {
+		t.Fatalf("get(%q) = %q, want missing", key, data)
+	}
+}
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	l := newLRUCache(3, time.Minute)
+	for _, key := range []string{"a", "b", "c"} {
+		l.add(key, []byte(key), 0, l.generation())
+	}
+
+	// Чтение делает a недавно использованным, поэтому вытесняется b
+	expectLocal(t, l, "a", "a")
+	l.add("d", []byte("d"), 0, l.generation())
+
+	expectNoLocal(t, l, "b")
+	for _, key := range []string{"a", "c", "d"} {
+		expectLocal(t, l, key, key)
+	}
+	if stats := l.stats(); stats.Size != 3 || stats.Capacity != 3 || stats.Evictions != 1 {
+		t.Errorf("stats() = %+v, want size 3, capacity 3, 1 eviction", stats)
+	}
+}
+
+func TestLRUCacheOverwriteKeepsSize(t *testing.T) {
+	l := newLRUCache(2, time.Minute)
+	l.add("a", []byte("1"), 0, l.generation())
+	l.add("b", []byte("1"), 0, l.generation())
+	l.add("a", []byte("2"), 0, l.generation())
+
+	expectLocal(t, l, "a", "2")
+	expectLocal(t, l, "b", "1")
+	if stats := l.stats(); stats.Size != 2 || stats.Evictions != 0 {
+		t.Errorf("stats() = %+v, want size 2 and no evictions", stats)
+	}
+}
+
+func TestLRUCacheTTL(t *testing.T) {
+	l := newLRUCache(10, 100*time.Millisecond)
+	gen := l.generation()
+	l.add("cache-ttl", []byte("v"), 0, gen)
+	l.add("short", []byte("v"), 10*time.Millisecond, gen)
+	l.add("long", []byte("v"), time.Hour, gen)
+
+	time.Sleep(30 * time.Millisecond)
+	expectNoLocal(t, l, "short")
+	expectLocal(t, l, "cache-ttl", "v")
+
+	// Срок жизни не превышает ttl кеша, даже если expiration больше
+	time.Sleep(90 * time.Millisecond)
+	expectNoLocal(t, l, "cache-ttl")
+	expectNoLocal(t, l, "long")
+
+	if stats := l.stats(); stats.Size != 0 || stats.Evictions != 3 {
+		t.Errorf("stats() = %+v, want empty cache and 3 evictions", stats)
+	}
+}
+
+func TestLRUCacheGenerationGuard(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func(l *lruCache)
+	}{
+		{"delete", func(l *lruCache) { l.delete("other") }},
+		{"deletePattern", func(l *lruCache) { l.deletePattern("nothing:*") }},
+		{"purge", func(l *lruCache) { l.purge() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLRUCache(10, time.Minute)
+
+			// Значение прочитано из общего кеша до удаления и не должно
+			// попасть в локальный уровень после него
+			gen := l.generation()
+			tt.invalidate(l)
+			l.add("user:1", []byte("stale"), 0, gen)
+			expectNoLocal(t, l, "user:1")
+
+			l.add("user:1", []byte("fresh"), 0, l.generation())
+			expectLocal(t, l, "user:1", "fresh")
+		})
+	}
+}
+
+func TestLRUCacheGenerationGuardDropsOlderCopy(t *testing.T) {
+	l := newLRUCache(10, time.Minute)
+	l.add("worker:1", []byte("1"), 0, l.generation())
+
+	// Запись 2 началась до удаления другого ключа и не сохраняется; копия 1
+	// старше нее и тоже не должна читаться
+	gen := l.generation()
+	l.deletePattern("shared:*")
+	l.add("worker:1", []byte("2"), 0, gen)
+
+	expectNoLocal(t, l, "worker:1")
+}
+
+func TestLRUCacheDelete(t *testing.T) {
+	l := newLRUCache(10, time.Minute)
+	for _, key := range []string{"user:1", "user:2", "users:list:abc", "user:10"} {
+		l.add(key, []byte(key), 0, l.generation())
+	}
+
+	l.delete("user:1")
+	expectNoLocal(t, l, "user:1")
+	expectLocal(t, l, "user:10", "user:10")
+
+	l.deletePattern("user:*")
+	expectNoLocal(t, l, "user:2")
+	expectNoLocal(t, l, "user:10")
+	expectLocal(t, l, "users:list:abc", "users:list:abc")
+
+	l.purge()
+	expectNoLocal(t, l, "users:list:abc")
+	if stats := l.stats(); stats.Size != 0 || stats.Evictions != 0 {
+		t.Errorf("stats() = %+v, deletions are not evictions", stats)
+	}
+}
+
+func TestLRUCacheDisabled(t *testing.T) {
+	l := newLRUCache(0, time.Minute)
+	l.add("a", []byte("a"), 0, l.generation())
+	expectNoLocal(t, l, "a")
+}
+
+func TestTieredCacheHandleIgnoresOwnMessages(t *testing.T) {
+	tc := &TieredCache{local: newLRUCache(10, time.Minute), origin: "self", Channel: CacheInvalidationChannel}
+	for i := 0; i < 3; i++ {
+		key := "user:" + strconv.Itoa(i)
+		tc.local.add(key, []byte(key), 0, tc.local.generation())
+	}
+
+	tc.handle(`{"origin":"self","key":"user:0"}`)
+	expectLocal(t, tc.local, "user:0", "user:0")
+
+	tc.handle(`{"origin":"other","key":"user:0"}`)
+	expectNoLocal(t, tc.local, "user:0")
+
+	tc.handle(`{"origin":"other","pattern":"user:*"}`)
+	expectNoLocal(t, tc.local, "user:1")
+	expectNoLocal(t, tc.local, "user:2")
+
+	tc.handle(`not json`)
+}
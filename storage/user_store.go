@@ -1,31 +1,106 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"log"
+	"time"
+)
+
+// Допустимые статусы пользователя.
+const (
+	StatusActive    = "active"
+	StatusInactive  = "inactive"
+	StatusSuspended = "suspended"
 )
 
 // User описывает модель пользователя в базе данных.
+// Это внутренняя модель хранилища и кеша: в API она не сериализуется напрямую,
+// поэтому может содержать служебные поля.
 type User struct {
-	ID     int    `json:"id"`
-	Name   string `json:"name"`
-	Email  string `json:"email"`
-	Status string `json:"status"`
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Version увеличивается при каждом изменении и используется для
+	// оптимистичной блокировки. При обновлении ненулевое значение означает
+	// ожидаемую текущую версию записи.
+	Version int `json:"version"`
+	// DeletedAt заполнено у мягко удаленных пользователей.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// UserPatch описывает частичное обновление пользователя.
+// Поля со значением nil не изменяются.
+type UserPatch struct {
+	Name   *string
+	Email  *string
+	Status *string
+	// Version — ожидаемая текущая версия записи; 0 отключает проверку.
+	Version int
+}
+
+// IsEmpty сообщает, что патч не изменяет ни одного поля.
+func (p UserPatch) IsEmpty() bool {
+	return p.Name == nil && p.Email == nil && p.Status == nil
+}
+
+// userColumns — список колонок, который читается функцией scanUser.
+const userColumns = "id, name, email, COALESCE(status, 'active'), COALESCE(created_at, 'epoch'), COALESCE(updated_at, 'epoch'), version, deleted_at"
+
+// rowScanner — общий интерфейс *sql.Row и *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser читает пользователя из строки, выбранной по userColumns.
+func scanUser(row rowScanner) (User, error) {
+	var u User
+	var deletedAt sql.NullTime
+	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Status, &u.CreatedAt, &u.UpdatedAt, &u.Version, &deletedAt)
+	if deletedAt.Valid {
+		u.DeletedAt = &deletedAt.Time
+	}
+	return u, err
 }
 
 // UserStore определяет интерфейс для работы с хранилищем пользователей.
 type UserStore interface {
-	GetUsers() ([]User, error)
-	GetUser(id int) (*User, error)
-	CreateUser(user *User) error
-	UpdateUser(id int, user *User) error
-	DeleteUser(id int) error
+	ListUsers(ctx context.Context, opts ListOptions) (*UserPage, error)
+	GetUser(ctx context.Context, id int) (*User, error)
+	CreateUser(ctx context.Context, user *User) error
+	UpdateUser(ctx context.Context, id int, user *User) error
+	PatchUser(ctx context.Context, id int, patch UserPatch) (*User, error)
+	// DeleteUser мягко удаляет пользователя; ненулевая version задает
+	// ожидаемую текущую версию записи.
+	DeleteUser(ctx context.Context, id int, version int) error
+	// RestoreUser восстанавливает мягко удаленного пользователя.
+	RestoreUser(ctx context.Context, id int) (*User, error)
+	// PurgeDeletedUsers окончательно удаляет пользователей, мягко удаленных
+	// раньше, чем retention назад, и возвращает их ID.
+	PurgeDeletedUsers(ctx context.Context, retention time.Duration) ([]int, error)
+	// GetUserHistory возвращает историю изменений пользователя.
+	GetUserHistory(ctx context.Context, id int, opts HistoryOptions) (*EventPage, error)
+}
+
+// BatchUserStore — необязательный интерфейс UserStore для пакетных операций,
+// которые выполняются за один обмен с сервером.
+type BatchUserStore interface {
+	// GetUsersByIDs возвращает активных пользователей в порядке ids,
+	// пропуская отсутствующих.
+	GetUsersByIDs(ctx context.Context, ids []int) ([]User, error)
+	// BulkCreateUsers создает всех пользователей или ни одного и заполняет
+	// их ID и служебные поля.
+	BulkCreateUsers(ctx context.Context, users []*User) error
 }
 
 // PostgresStore реализует интерфейс UserStore для работы с PostgreSQL.
 type PostgresStore struct {
 	DB *sql.DB
+	// Replicas — необязательные реплики для чтения. Запись всегда идет в DB.
+	Replicas *ReplicaSet
 }
 
 // NewPostgresStore создает новый экземпляр PostgresStore.
@@ -33,42 +108,73 @@ func NewPostgresStore(db *sql.DB) *PostgresStore {
 	return &PostgresStore{DB: db}
 }
 
-// GetUsers возвращает всех пользователей из БД.
-func (s *PostgresStore) GetUsers() ([]User, error) {
-	log.Println("Fetching all users from database")
-	rows, err := s.DB.Query("SELECT id, name, email, COALESCE(status, 'active') FROM users")
+// reader возвращает пул для чтения: исправную реплику, если она есть
+// и контекст не требует чтения с основного сервера, иначе основной пул.
+func (s *PostgresStore) reader(ctx context.Context) *sql.DB {
+	if s.Replicas == nil || usePrimary(ctx) {
+		return s.DB
+	}
+	if db := s.Replicas.Pick(); db != nil {
+		return db
+	}
+	return s.DB
+}
+
+// ListUsers возвращает страницу пользователей с учетом фильтров и сортировки.
+// Постраничная выборка строится по ключу (keyset) на id, поэтому ее стоимость
+// не зависит от номера страницы.
+func (s *PostgresStore) ListUsers(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	opts = opts.Normalize()
+	log.Printf("Listing users: %+v", opts)
+
+	query, args, err := buildListQuery(opts)
 	if err != nil {
-		log.Printf("Error querying users: %v", err)
 		return nil, err
 	}
+
+	rows, err := s.reader(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Printf("Error querying users: %v", err)
+		return nil, translateError(err)
+	}
 	defer rows.Close()
 
-	var users []User
+	users := make([]User, 0, opts.Limit)
 	for rows.Next() {
-		var u User
-		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Status); err != nil {
+		u, err := scanUser(rows)
+		if err != nil {
 			log.Printf("Error scanning user row: %v", err)
-			return nil, err
+			return nil, translateError(err)
 		}
 		users = append(users, u)
 	}
-	log.Printf("Successfully fetched %d users", len(users))
-	return users, nil
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating user rows: %v", err)
+		return nil, translateError(err)
+	}
+
+	page := newUserPage(users, opts)
+	log.Printf("Successfully fetched %d users", len(page.Users))
+	return page, nil
 }
 
 // CreateUser создает нового пользователя в БД.
-func (s *PostgresStore) CreateUser(user *User) error {
+func (s *PostgresStore) CreateUser(ctx context.Context, user *User) error {
 	log.Printf("Creating user: %s (%s)", user.Name, user.Email)
-	
+
 	// Устанавливаем статус по умолчанию, если не указан
 	if user.Status == "" {
-		user.Status = "active"
+		user.Status = StatusActive
 	}
-	
-	err := s.DB.QueryRow(
-		"INSERT INTO users (name, email, status) VALUES ($1, $2, $3) RETURNING id",
-		user.Name, user.Email, user.Status,
-	).Scan(&user.ID)
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		created, err := scanUser(tx.QueryRowContext(ctx, insertUserSQL, user.Name, user.Email, user.Status))
+		if err != nil {
+			return translateError(err)
+		}
+		*user = created
+		return s.recordEvent(ctx, tx, user.ID, OpCreate, nil, user)
+	})
 	if err != nil {
 		log.Printf("Error creating user: %v", err)
 		return err
@@ -78,67 +184,277 @@ func (s *PostgresStore) CreateUser(user *User) error {
 }
 
 // GetUser находит одного пользователя по ID.
-func (s *PostgresStore) GetUser(id int) (*User, error) {
+func (s *PostgresStore) GetUser(ctx context.Context, id int) (*User, error) {
 	log.Printf("Fetching user with ID: %d", id)
-	var u User
-	err := s.DB.QueryRow("SELECT id, name, email, COALESCE(status, 'active') FROM users WHERE id = $1", id).Scan(&u.ID, &u.Name, &u.Email, &u.Status)
+	u, err := scanUser(s.reader(ctx).QueryRowContext(ctx, selectUserSQL, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("User with ID %d not found", id)
-			return nil, fmt.Errorf("user with id %d not found", id)
+			return nil, errUserNotFound(id)
 		}
 		log.Printf("Error fetching user %d: %v", id, err)
-		return nil, err
+		return nil, translateError(err)
 	}
 	log.Printf("Successfully fetched user: %s (%s)", u.Name, u.Email)
 	return &u, nil
 }
 
 // UpdateUser обновляет данные пользователя по ID.
-func (s *PostgresStore) UpdateUser(id int, user *User) error {
+func (s *PostgresStore) UpdateUser(ctx context.Context, id int, user *User) error {
 	log.Printf("Updating user %d: %s (%s)", id, user.Name, user.Email)
-	
-	// Устанавливаем статус по умолчанию, если не указан
-	if user.Status == "" {
-		user.Status = "active"
-	}
-	
-	result, err := s.DB.Exec("UPDATE users SET name = $1, email = $2, status = $3 WHERE id = $4", user.Name, user.Email, user.Status, id)
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// Строка блокируется до конца транзакции, поэтому проверка версии атомарна
+		before, err := lockUser(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(before, user.Version); err != nil {
+			return err
+		}
+
+		// Если статус не указан, сохраняем текущий: иначе обновление одного имени
+		// могло бы, например, снова активировать заблокированного пользователя
+		status := user.Status
+		if status == "" {
+			status = before.Status
+		}
+
+		updated, err := scanUser(tx.QueryRowContext(ctx, updateUserSQL, user.Name, user.Email, status, id))
+		if err != nil {
+			return translateError(err)
+		}
+		*user = updated
+		return s.recordEvent(ctx, tx, id, OpUpdate, before, user)
+	})
 	if err != nil {
 		log.Printf("Error updating user %d: %v", id, err)
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		log.Printf("Error getting rows affected for user %d: %v", id, err)
-		return err
-	}
-	if rowsAffected == 0 {
-		log.Printf("User with ID %d not found for update", id)
-		return fmt.Errorf("user with id %d not found", id)
-	}
 	log.Printf("Successfully updated user %d", id)
 	return nil
 }
 
-// DeleteUser удаляет пользователя по ID.
-func (s *PostgresStore) DeleteUser(id int) error {
+// PatchUser обновляет только переданные в патче поля пользователя
+// и возвращает его актуальное состояние.
+func (s *PostgresStore) PatchUser(ctx context.Context, id int, patch UserPatch) (*User, error) {
+	if patch.IsEmpty() {
+		// Версию проверяем по основному серверу, а не по отстающей реплике
+		u, err := s.GetUser(WithPrimary(ctx), id)
+		if err != nil {
+			return nil, err
+		}
+		return u, checkVersion(u, patch.Version)
+	}
+	log.Printf("Patching user %d", id)
+
+	query, args := buildPatchQuery(id, patch)
+
+	var patched User
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockUser(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(before, patch.Version); err != nil {
+			return err
+		}
+
+		patched, err = scanUser(tx.QueryRowContext(ctx, query, args...))
+		if err != nil {
+			return translateError(err)
+		}
+		return s.recordEvent(ctx, tx, id, OpUpdate, before, &patched)
+	})
+	if err != nil {
+		log.Printf("Error patching user %d: %v", id, err)
+		return nil, err
+	}
+	log.Printf("Successfully patched user %d", id)
+	return &patched, nil
+}
+
+// DeleteUser мягко удаляет пользователя по ID: запись остается в БД
+// с заполненным deleted_at и может быть восстановлена.
+func (s *PostgresStore) DeleteUser(ctx context.Context, id int, version int) error {
 	log.Printf("Deleting user with ID: %d", id)
-	result, err := s.DB.Exec("DELETE FROM users WHERE id = $1", id)
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockUser(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(before, version); err != nil {
+			return err
+		}
+
+		deleted, err := scanUser(tx.QueryRowContext(ctx, softDeleteUserSQL, id))
+		if err != nil {
+			return translateError(err)
+		}
+		return s.recordEvent(ctx, tx, id, OpDelete, before, &deleted)
+	})
 	if err != nil {
 		log.Printf("Error deleting user %d: %v", id, err)
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
+	log.Printf("Successfully deleted user %d", id)
+	return nil
+}
+
+// RestoreUser восстанавливает мягко удаленного пользователя.
+func (s *PostgresStore) RestoreUser(ctx context.Context, id int) (*User, error) {
+	log.Printf("Restoring user with ID: %d", id)
+	var restored User
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockUser(ctx, tx, id, true)
+		if err != nil {
+			return err
+		}
+
+		restored, err = scanUser(tx.QueryRowContext(ctx, restoreUserSQL, id))
+		if err != nil {
+			return translateError(err)
+		}
+		return s.recordEvent(ctx, tx, id, OpRestore, before, &restored)
+	})
+	if err != nil {
+		log.Printf("Error restoring user %d: %v", id, err)
+		return nil, err
+	}
+	log.Printf("Successfully restored user %d", id)
+	return &restored, nil
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, мягко удаленных
+// раньше, чем retention назад.
+func (s *PostgresStore) PurgeDeletedUsers(ctx context.Context, retention time.Duration) ([]int, error) {
+	log.Printf("Purging users deleted more than %v ago", retention)
+	var ids []int
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, purgeUsersSQL, retention.Seconds())
+		if err != nil {
+			return translateError(err)
+		}
+
+		// События записываются после чтения всех строк: в одной транзакции
+		// нельзя выполнять запрос, пока открыт курсор предыдущего
+		var purged []User
+		for rows.Next() {
+			u, err := scanUser(rows)
+			if err != nil {
+				rows.Close()
+				return translateError(err)
+			}
+			purged = append(purged, u)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return translateError(err)
+		}
+
+		for i := range purged {
+			if err := s.recordEvent(ctx, tx, purged[i].ID, OpPurge, &purged[i], nil); err != nil {
+				return err
+			}
+			ids = append(ids, purged[i].ID)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error purging deleted users: %v", err)
+		return nil, err
+	}
+	log.Printf("Successfully purged %d users", len(ids))
+	return ids, nil
+}
+
+// GetUserHistory возвращает историю изменений пользователя от новых событий
+// к старым. История доступна и для удаленных пользователей.
+func (s *PostgresStore) GetUserHistory(ctx context.Context, id int, opts HistoryOptions) (*EventPage, error) {
+	opts = opts.Normalize()
+	log.Printf("Fetching history of user %d", id)
+
+	query, args, err := buildHistoryQuery(id, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.reader(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Printf("Error querying history of user %d: %v", id, err)
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	events := make([]UserEvent, 0, opts.Limit)
+	for rows.Next() {
+		var (
+			e             UserEvent
+			before, after []byte
+		)
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Actor, &e.Operation, &before, &after, &e.CreatedAt); err != nil {
+			log.Printf("Error scanning user event row: %v", err)
+			return nil, translateError(err)
+		}
+		e.Before, e.After = before, after
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating user events: %v", err)
+		return nil, translateError(err)
+	}
+
+	if len(events) == 0 && opts.Cursor == "" {
+		var exists bool
+		if err := s.reader(ctx).QueryRowContext(ctx, userExistsSQL, id).Scan(&exists); err != nil {
+			return nil, translateError(err)
+		}
+		if !exists {
+			return nil, errUserNotFound(id)
+		}
+	}
+
+	return newEventPage(events, opts), nil
+}
+
+// withTx выполняет fn в транзакции и фиксирует ее, если fn не вернула ошибку.
+func (s *PostgresStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return translateError(err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return translateError(tx.Commit())
+}
+
+// recordEvent записывает событие истории и событие outbox в транзакции
+// изменения пользователя.
+func (s *PostgresStore) recordEvent(ctx context.Context, tx *sql.Tx, userID int, op string, before, after *User) error {
+	auditArgs, outboxArgs, err := eventArgs(ctx, userID, op, before, after)
 	if err != nil {
-		log.Printf("Error getting rows affected for user deletion %d: %v", id, err)
 		return err
 	}
-	if rowsAffected == 0 {
-		log.Printf("User with ID %d not found for deletion", id)
-		return fmt.Errorf("user with id %d not found", id)
+	if _, err := tx.ExecContext(ctx, insertUserEventSQL, auditArgs...); err != nil {
+		return translateError(err)
+	}
+	if _, err := tx.ExecContext(ctx, insertOutboxSQL, outboxArgs...); err != nil {
+		return translateError(err)
 	}
-	log.Printf("Successfully deleted user %d", id)
 	return nil
 }
 
+// lockUser читает пользователя и блокирует строку до конца транзакции.
+// deleted выбирает мягко удаленных пользователей вместо активных.
+func lockUser(ctx context.Context, tx *sql.Tx, id int, deleted bool) (*User, error) {
+	u, err := scanUser(tx.QueryRowContext(ctx, lockUserSQL(deleted), id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, lockedUserNotFound(id, deleted)
+		}
+		return nil, translateError(err)
+	}
+	return &u, nil
+}
@@ -0,0 +1,42 @@
+package storage_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/avetis74/12_app_factors/storage"
+	"github.com/avetis74/12_app_factors/storage/storagetest"
+)
+
+// testDatabaseURL возвращает адрес тестовой БД с примененными миграциями
+// или пропускает тест, если TEST_DATABASE_URL не задан.
+func testDatabaseURL(tb testing.TB) string {
+	tb.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		tb.Skip("TEST_DATABASE_URL is not set")
+	}
+	return url
+}
+
+// openTestDB открывает тестовую БД через lib/pq.
+func openTestDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	db, err := sql.Open("postgres", testDatabaseURL(tb))
+	if err != nil {
+		tb.Fatalf("open test database: %v", err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	if err := db.Ping(); err != nil {
+		tb.Fatalf("test database is not reachable: %v", err)
+	}
+	return db
+}
+
+func TestPostgresStore(t *testing.T) {
+	db := openTestDB(t)
+	storagetest.TestUserStore(t, func(t *testing.T) storage.UserStore {
+		return storage.NewPostgresStore(db)
+	})
+}